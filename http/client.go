@@ -0,0 +1,155 @@
+package http
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/xtracker/limits"
+)
+
+// LimitExceededError is returned by the transport when the client side limit of a host is reached,
+// the request was not sent
+type LimitExceededError struct {
+	Host string
+	Err  error
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("limits error: client limit exceeded for %s: %v", e.Host, e.Err)
+}
+
+func (e *LimitExceededError) Unwrap() error {
+	return e.Err
+}
+
+// ResponseClassifier maps the outcome of a round trip to the result fed to the limit
+type ResponseClassifier func(resp *http.Response, err error) limits.Result
+
+// DefaultResponseClassifier drops transport errors, timeouts, 429 and 5xx responses,
+// and ignores requests canceled by the caller
+func DefaultResponseClassifier(resp *http.Response, err error) limits.Result {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return limits.IGNORED
+	case err != nil:
+		return limits.DROPPED
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return limits.DROPPED
+	default:
+		return limits.SUCCESS
+	}
+}
+
+type transportBuilder struct {
+	base       http.RoundTripper
+	factory    func(host string) limits.Limiter
+	classifier ResponseClassifier
+	maxHosts   int
+}
+
+// NewTransportBuilder limits the requests sent to every host with a limiter created by factory
+func NewTransportBuilder(factory func(host string) limits.Limiter) *transportBuilder {
+	return &transportBuilder{
+		base:       http.DefaultTransport,
+		factory:    factory,
+		classifier: DefaultResponseClassifier,
+		maxHosts:   1024,
+	}
+}
+
+// MaxHosts bounds the number of limiters kept, 1024 by default. The limiter of the least
+// recently used host is dropped beyond, and created again by factory if the host is called
+// later, so factory should create a new limit for every host rather than share one.
+func (tb *transportBuilder) MaxHosts(max int) *transportBuilder {
+	tb.maxHosts = max
+	return tb
+}
+
+// Base is the transport requests are sent with, http.DefaultTransport by default
+func (tb *transportBuilder) Base(base http.RoundTripper) *transportBuilder {
+	tb.base = base
+	return tb
+}
+
+func (tb *transportBuilder) Classifier(classifier ResponseClassifier) *transportBuilder {
+	tb.classifier = classifier
+	return tb
+}
+
+func (tb *transportBuilder) Build() http.RoundTripper {
+	if tb.base == nil || tb.factory == nil || tb.classifier == nil {
+		panic("http: base, factory and classifier must not be nil")
+	}
+
+	if tb.maxHosts <= 0 {
+		panic("http: max hosts must be positive")
+	}
+
+	return &transport{
+		base:       tb.base,
+		factory:    tb.factory,
+		classifier: tb.classifier,
+		maxHosts:   tb.maxHosts,
+		limiters:   make(map[string]*list.Element),
+	}
+}
+
+type hostLimiter struct {
+	host    string
+	limiter limits.Limiter
+}
+
+// transport releases the permit once the response headers are received,
+// the time spent reading the body is not part of the sample
+type transport struct {
+	sync.Mutex
+	base       http.RoundTripper
+	factory    func(host string) limits.Limiter
+	classifier ResponseClassifier
+	maxHosts   int
+	limiters   map[string]*list.Element
+	lru        list.List // of *hostLimiter, most recently used at front
+}
+
+func (t *transport) limiter(host string) limits.Limiter {
+	t.Lock()
+	defer t.Unlock()
+
+	if e, ok := t.limiters[host]; ok {
+		t.lru.MoveToFront(e)
+		return e.Value.(*hostLimiter).limiter
+	}
+
+	if t.lru.Len() >= t.maxHosts {
+		// the permits in flight are still released to the dropped limiter
+		oldest := t.lru.Remove(t.lru.Back()).(*hostLimiter)
+		delete(t.limiters, oldest.host)
+	}
+
+	l := t.factory(host)
+	t.limiters[host] = t.lru.PushFront(&hostLimiter{host: host, limiter: l})
+	return l
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	ctx := req.Context()
+
+	listener, err := t.limiter(host).Acquire(ctx)
+	if err != nil {
+		// the request body must be closed by the transport even if it is not sent
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		return nil, &LimitExceededError{Host: host, Err: err}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	listener(ctx, t.classifier(resp, err))
+	return resp, err
+}
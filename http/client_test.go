@@ -0,0 +1,132 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+func TestTransportPerHost(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	limiters := map[string]*recordingLimiter{}
+	client := &http.Client{
+		Transport: NewTransportBuilder(func(host string) limits.Limiter {
+			limiters[host] = &recordingLimiter{admit: true}
+			return limiters[host]
+		}).Build(),
+	}
+
+	for _, server := range []*httptest.Server{ok, ok, failing} {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if len(limiters) != 2 {
+		t.Fatalf("expected one limiter per host, got %d", len(limiters))
+	}
+
+	okHost, _ := url.Parse(ok.URL)
+	if results := limiters[okHost.Host].results; len(results) != 2 || results[0] != limits.SUCCESS || results[1] != limits.SUCCESS {
+		t.Fatalf("unexpected results %v", results)
+	}
+
+	failingHost, _ := url.Parse(failing.URL)
+	if results := limiters[failingHost.Host].results; len(results) != 1 || results[0] != limits.DROPPED {
+		t.Fatalf("unexpected results %v", results)
+	}
+}
+
+func TestTransportErrors(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	l := &recordingLimiter{admit: true}
+	client := &http.Client{
+		Timeout: 20 * time.Millisecond,
+		Transport: NewTransportBuilder(func(string) limits.Limiter {
+			return l
+		}).Build(),
+	}
+
+	if _, err := client.Get(slow.URL); err == nil {
+		t.Fatal("expected timeout")
+	}
+
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+	if _, err := client.Get(closed.URL); err == nil {
+		t.Fatal("expected connection error")
+	}
+
+	if len(l.results) != 2 || l.results[0] != limits.DROPPED || l.results[1] != limits.DROPPED {
+		t.Fatalf("expected timeouts and transport errors to be dropped, got %v", l.results)
+	}
+}
+
+func TestTransportLimitExceeded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not be sent")
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: NewTransportBuilder(func(string) limits.Limiter {
+			return &recordingLimiter{}
+		}).Build(),
+	}
+
+	_, err := client.Get(server.URL)
+	var limitErr *LimitExceededError
+	if !errors.As(err, &limitErr) || !errors.Is(err, errRejected) {
+		t.Fatalf("expected limit exceeded error, got %v", err)
+	}
+
+	if u, _ := url.Parse(server.URL); limitErr.Host != u.Host {
+		t.Fatalf("unexpected host %q", limitErr.Host)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTransportMaxHosts(t *testing.T) {
+	var created []string
+	transport := NewTransportBuilder(func(host string) limits.Limiter {
+		created = append(created, host)
+		return &recordingLimiter{admit: true}
+	}).Base(roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})).MaxHosts(2).Build()
+
+	for _, host := range []string{"a", "b", "a", "c", "b"} {
+		if _, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// c evicts b, the least recently used, then b evicts a
+	if strings.Join(created, "") != "abcb" {
+		t.Fatalf("unexpected limiters created %v", created)
+	}
+}
@@ -0,0 +1,195 @@
+package http
+
+import (
+	"bufio"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xtracker/limits"
+	"github.com/xtracker/limits/limiter"
+)
+
+// Classifier maps the outcome of a request to the result fed to the limit,
+// recovered is the value of a panic in the handler, nil if it returned normally
+type Classifier func(status int, recovered interface{}) limits.Result
+
+// DefaultClassifier drops panics and 5xx responses, and ignores aborted requests
+func DefaultClassifier(status int, recovered interface{}) limits.Result {
+	switch {
+	case recovered == http.ErrAbortHandler:
+		return limits.IGNORED
+	case recovered != nil:
+		return limits.DROPPED
+	case status >= http.StatusInternalServerError:
+		return limits.DROPPED
+	default:
+		return limits.SUCCESS
+	}
+}
+
+type middlewareBuilder struct {
+	limiter    limits.Limiter
+	classifier Classifier
+	status     int
+	retryAfter time.Duration
+	body       string
+	priority   func(*http.Request) (int, bool)
+}
+
+func NewMiddlewareBuilder(l limits.Limiter) *middlewareBuilder {
+	return &middlewareBuilder{
+		limiter:    l,
+		classifier: DefaultClassifier,
+		status:     http.StatusTooManyRequests,
+		retryAfter: time.Second,
+	}
+}
+
+func (mb *middlewareBuilder) Classifier(classifier Classifier) *middlewareBuilder {
+	mb.classifier = classifier
+	return mb
+}
+
+// Reject configures the response of rejected requests, usually 429 or 503.
+// Retry-After is rounded up to seconds and omitted when retryAfter is 0
+func (mb *middlewareBuilder) Reject(status int, retryAfter time.Duration, body string) *middlewareBuilder {
+	mb.status, mb.retryAfter, mb.body = status, retryAfter, body
+	return mb
+}
+
+// Priority derives the priority used by the priority limiter from the request
+func (mb *middlewareBuilder) Priority(priority func(*http.Request) (int, bool)) *middlewareBuilder {
+	mb.priority = priority
+	return mb
+}
+
+// PriorityHeader reads the priority from an integer header, requests without it keep the default priority
+func (mb *middlewareBuilder) PriorityHeader(header string) *middlewareBuilder {
+	return mb.Priority(func(r *http.Request) (int, bool) {
+		priority, err := strconv.Atoi(r.Header.Get(header))
+		return priority, err == nil
+	})
+}
+
+func (mb *middlewareBuilder) Build() func(http.Handler) http.Handler {
+	if mb.limiter == nil || mb.classifier == nil {
+		panic("http: limiter and classifier must not be nil")
+	}
+
+	if mb.status < 400 || mb.status > 599 {
+		panic("http: reject status must be a 4xx or 5xx code")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return &handler{
+			next:       next,
+			limiter:    mb.limiter,
+			classifier: mb.classifier,
+			status:     mb.status,
+			retryAfter: mb.retryAfter,
+			body:       mb.body,
+			priority:   mb.priority,
+		}
+	}
+}
+
+type handler struct {
+	next       http.Handler
+	limiter    limits.Limiter
+	classifier Classifier
+	status     int
+	retryAfter time.Duration
+	body       string
+	priority   func(*http.Request) (int, bool)
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if h.priority != nil {
+		if priority, ok := h.priority(r); ok {
+			ctx = limiter.WithPriority(ctx, priority)
+			r = r.WithContext(ctx)
+		}
+	}
+
+	listener, err := h.limiter.Acquire(ctx)
+	if err != nil {
+		h.reject(w)
+		return
+	}
+
+	rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		recovered := recover()
+		listener(ctx, h.classifier(rw.status, recovered))
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+
+	h.next.ServeHTTP(rw, r)
+}
+
+func (h *handler) reject(w http.ResponseWriter) {
+	if h.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(h.retryAfter.Seconds()))))
+	}
+
+	if h.body == "" {
+		w.WriteHeader(h.status)
+		return
+	}
+
+	http.Error(w, h.body, h.status)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status, s.wroteHeader = status, true
+	}
+
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush is a no-op if the underlying writer can't flush
+func (s *statusRecorder) Flush() {
+	s.wroteHeader = true
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack returns http.ErrNotSupported if the underlying writer can't be hijacked
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, rw, err := h.Hijack()
+	if err == nil && !s.wroteHeader {
+		// the handler owns the connection, eg. to switch protocols
+		s.status, s.wroteHeader = http.StatusSwitchingProtocols, true
+	}
+
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,174 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xtracker/limits"
+	"github.com/xtracker/limits/limiter"
+)
+
+var errRejected = errors.New("rejected")
+
+type recordingLimiter struct {
+	admit   bool
+	ctx     context.Context
+	results []limits.Result
+}
+
+func (r *recordingLimiter) Acquire(ctx context.Context) (limits.Listener, error) {
+	r.ctx = ctx
+	if !r.admit {
+		return nil, errRejected
+	}
+
+	return func(_ context.Context, result limits.Result) {
+		r.results = append(r.results, result)
+	}, nil
+}
+
+func serve(t *testing.T, middleware func(http.Handler) http.Handler, h http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	func() {
+		defer func() { recover() }()
+		middleware(h).ServeHTTP(rec, req)
+	}()
+
+	return rec
+}
+
+func TestMiddlewareClassifies(t *testing.T) {
+	l := &recordingLimiter{admit: true}
+	middleware := NewMiddlewareBuilder(l).Build()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	serve(t, middleware, func(w http.ResponseWriter, r *http.Request) {}, req)
+	serve(t, middleware, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}, req)
+	serve(t, middleware, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusServiceUnavailable)
+	}, req)
+	serve(t, middleware, func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}, req)
+	serve(t, middleware, func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}, req)
+
+	expected := []limits.Result{limits.SUCCESS, limits.SUCCESS, limits.DROPPED, limits.DROPPED, limits.IGNORED}
+	if len(l.results) != len(expected) {
+		t.Fatalf("expected results %v, got %v", expected, l.results)
+	}
+
+	for i := range expected {
+		if l.results[i] != expected[i] {
+			t.Fatalf("expected results %v, got %v", expected, l.results)
+		}
+	}
+}
+
+func TestMiddlewareRepanics(t *testing.T) {
+	middleware := NewMiddlewareBuilder(&recordingLimiter{admit: true}).Build()
+
+	defer func() {
+		if recovered := recover(); recovered != "boom" {
+			t.Fatalf("expected the panic to be propagated, got %v", recovered)
+		}
+	}()
+
+	middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestMiddlewareRejects(t *testing.T) {
+	called := false
+	h := func(w http.ResponseWriter, r *http.Request) { called = true }
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	rec := serve(t, NewMiddlewareBuilder(&recordingLimiter{}).Build(), h, req)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" || called {
+		t.Fatalf("unexpected rejection %d %v", rec.Code, rec.Header())
+	}
+
+	middleware := NewMiddlewareBuilder(&recordingLimiter{}).Reject(http.StatusServiceUnavailable, 0, "overloaded").Build()
+	rec = serve(t, middleware, h, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "" || rec.Body.String() != "overloaded\n" {
+		t.Fatalf("unexpected rejection %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+}
+
+func TestMiddlewarePriorityHeader(t *testing.T) {
+	l := &recordingLimiter{admit: true}
+	middleware := NewMiddlewareBuilder(l).PriorityHeader("X-Priority").Build()
+	h := func(w http.ResponseWriter, r *http.Request) {}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Priority", "7")
+	serve(t, middleware, h, req)
+	if priority, ok := limiter.PriorityFromContext(l.ctx); !ok || priority != 7 {
+		t.Fatalf("expected priority 7, got %d %v", priority, ok)
+	}
+
+	serve(t, middleware, h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if _, ok := limiter.PriorityFromContext(l.ctx); ok {
+		t.Fatal("expected no priority without header")
+	}
+}
+
+func TestMiddlewareFlush(t *testing.T) {
+	middleware := NewMiddlewareBuilder(&recordingLimiter{admit: true}).Build()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	rec := serve(t, middleware, func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+	}, req)
+
+	if !rec.Flushed {
+		t.Fatal("expected the flush to reach the underlying writer")
+	}
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	middleware := NewMiddlewareBuilder(&recordingLimiter{admit: true}).Build()
+
+	// the recorder can't be hijacked
+	var hijackErr error
+	serve(t, middleware, func(w http.ResponseWriter, r *http.Request) {
+		_, _, hijackErr = w.(http.Hijacker).Hijack()
+	}, httptest.NewRequest(http.MethodGet, "/", nil))
+	if hijackErr != http.ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported, got %v", hijackErr)
+	}
+
+	srv := httptest.NewServer(middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hijacked" {
+		t.Fatalf("expected the hijacked response, got %q", body)
+	}
+}
@@ -0,0 +1,114 @@
+package limit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+type aimdBuilder struct {
+	initial, min, max float64
+	backoffRatio      float64
+	timeout           time.Duration
+}
+
+func NewAIMDBuilder() *aimdBuilder {
+	return &aimdBuilder{
+		initial:      20,
+		min:          20,
+		max:          200,
+		backoffRatio: 0.9,
+		timeout:      5 * time.Second,
+	}
+}
+
+func (a *aimdBuilder) Initial(initial float64) *aimdBuilder {
+	a.initial = initial
+	return a
+}
+
+func (a *aimdBuilder) MinMax(min, max float64) *aimdBuilder {
+	a.min, a.max = min, max
+	return a
+}
+
+// BackoffRatio is the factor applied to the limit when a sample is dropped or timed out
+func (a *aimdBuilder) BackoffRatio(ratio float64) *aimdBuilder {
+	a.backoffRatio = ratio
+	return a
+}
+
+// Timeout is the rtt above which a sample is treated as dropped
+func (a *aimdBuilder) Timeout(timeout time.Duration) *aimdBuilder {
+	a.timeout = timeout
+	return a
+}
+
+func (a *aimdBuilder) validate() error {
+	switch {
+	case a.min < 1 || a.min > a.max:
+		return fmt.Errorf("aimd: min %v and max %v must satisfy 1 <= min <= max", a.min, a.max)
+	case a.initial < a.min || a.initial > a.max:
+		return fmt.Errorf("aimd: initial limit %v must be in [%v, %v]", a.initial, a.min, a.max)
+	case a.backoffRatio < 0.5 || a.backoffRatio >= 1:
+		return fmt.Errorf("aimd: backoff ratio %v must be in [0.5, 1)", a.backoffRatio)
+	case a.timeout <= 0:
+		return fmt.Errorf("aimd: timeout %v must be positive", a.timeout)
+	}
+
+	return nil
+}
+
+func (a *aimdBuilder) Build() limits.Limit {
+	if err := a.validate(); err != nil {
+		panic(err)
+	}
+
+	return &AIMDLimit{
+		baseLimit:    baseLimit{id: "aimd", limit: int32(a.initial)},
+		currentLimit: a.initial,
+		minLimit:     a.min,
+		maxLimit:     a.max,
+		backoffRatio: a.backoffRatio,
+		timeout:      a.timeout,
+	}
+}
+
+// AIMDLimit is a loss based limit, it grows additively while samples succeed and
+// backs off multiplicatively when a sample is dropped or exceeds the timeout
+type AIMDLimit struct {
+	baseLimit
+
+	mu sync.Mutex
+
+	currentLimit float64
+
+	minLimit, maxLimit float64
+
+	backoffRatio float64
+
+	timeout time.Duration
+}
+
+func (al *AIMDLimit) OnSample(ctx context.Context, startTime time.Time, rtt time.Duration, inflight int, didDrop bool) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	current := al.currentLimit
+
+	if didDrop || rtt > al.timeout {
+		current = current * al.backoffRatio
+	} else if inflight*2 >= int(current) {
+		// only grow when the limit is actually used
+		current = current + 1
+	}
+
+	current = math.Max(al.minLimit, math.Min(al.maxLimit, current))
+	al.currentLimit = current
+
+	al.setLimit(int(current))
+}
@@ -0,0 +1,70 @@
+package limit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAIMDLimit(t *testing.T) {
+	cases := []struct {
+		name     string
+		rtt      time.Duration
+		inflight int
+		dropped  bool
+		expected int
+	}{
+		{"success grows by one", 10 * time.Millisecond, 10, false, 21},
+		{"drop backs off", 10 * time.Millisecond, 10, true, 18},
+		{"timeout backs off", 2 * time.Second, 10, false, 18},
+		{"app limited holds", 10 * time.Millisecond, 9, false, 20},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := NewAIMDBuilder().Initial(20).MinMax(1, 100).Timeout(time.Second).Build()
+			feedOne(l, c.rtt, c.inflight, c.dropped)
+			if l.GetLimit() != c.expected {
+				t.Fatalf("expected limit %d, got %d", c.expected, l.GetLimit())
+			}
+		})
+	}
+}
+
+func TestAIMDLimitBounds(t *testing.T) {
+	l := NewAIMDBuilder().Initial(20).MinMax(10, 30).BackoffRatio(0.5).Build()
+
+	for i := 0; i < 20; i++ {
+		feedOne(l, time.Millisecond, 30, false)
+	}
+	if l.GetLimit() != 30 {
+		t.Fatalf("expected limit to be clamped at max 30, got %d", l.GetLimit())
+	}
+
+	for i := 0; i < 5; i++ {
+		feedOne(l, time.Millisecond, 30, true)
+	}
+	if l.GetLimit() != 10 {
+		t.Fatalf("expected limit to be clamped at min 10, got %d", l.GetLimit())
+	}
+}
+
+func TestAIMDBuilderValidate(t *testing.T) {
+	cases := map[string]*aimdBuilder{
+		"min":     NewAIMDBuilder().MinMax(0, 10).Initial(5),
+		"max":     NewAIMDBuilder().MinMax(20, 10),
+		"initial": NewAIMDBuilder().Initial(500),
+		"backoff": NewAIMDBuilder().BackoffRatio(1),
+		"timeout": NewAIMDBuilder().Timeout(0),
+	}
+
+	for name, b := range cases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected Build to panic")
+				}
+			}()
+			b.Build()
+		})
+	}
+}
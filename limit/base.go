@@ -24,15 +24,15 @@ func (b *baseLimit) GetLimit() int {
 	return int(atomic.LoadInt32(&b.limit))
 }
 
+// setLimit stores and publishes under lock, so listeners observe changes in the order they are made
 func (b *baseLimit) setLimit(new int) {
-	if b.GetLimit() == new {
-		return
-	}
-
-	atomic.StoreInt32(&b.limit, int32(new))
 	b.Lock()
 	defer b.Unlock()
 
+	if atomic.SwapInt32(&b.limit, int32(new)) == int32(new) {
+		return
+	}
+
 	for _, listener := range b.listeners {
 		listener(new)
 	}
@@ -0,0 +1,291 @@
+package limit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xtracker/limits"
+	"github.com/xtracker/limits/limit/window"
+	"github.com/xtracker/limits/util"
+)
+
+type BBRPhase int
+
+const (
+	BBRStartup  BBRPhase = iota // grow exponentially until the delivery rate stops growing
+	BBRDrain                    // drain the queue built during startup
+	BBRProbeBW                  // cycle around the estimated bdp to probe for more bandwidth
+	BBRProbeRTT                 // shrink to the min limit to refresh the min rtt
+)
+
+func (p BBRPhase) String() string {
+	switch p {
+	case BBRStartup:
+		return "startup"
+	case BBRDrain:
+		return "drain"
+	case BBRProbeBW:
+		return "probe_bw"
+	case BBRProbeRTT:
+		return "probe_rtt"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	bbrHighGain         = 2.885 // 2/ln(2), doubles the delivery rate every round
+	bbrFullBwThreshold  = 1.25
+	bbrFullBwRounds     = 3
+	bbrMinRoundInterval = time.Millisecond
+)
+
+var bbrProbeBWGains = [...]float64{1.25, 0.75, 1, 1, 1, 1, 1, 1}
+
+type bbrBuilder struct {
+	initial, min, max float64
+	gain              float64
+	minRttWindow      time.Duration
+	rateWindow        time.Duration
+	probeRttDuration  time.Duration
+}
+
+func NewBBRBuilder() *bbrBuilder {
+	return &bbrBuilder{
+		initial:          20,
+		min:              4,
+		max:              1000,
+		gain:             2,
+		minRttWindow:     10 * time.Second,
+		rateWindow:       2 * time.Second,
+		probeRttDuration: 200 * time.Millisecond,
+	}
+}
+
+func (b *bbrBuilder) Initial(initial float64) *bbrBuilder {
+	b.initial = initial
+	return b
+}
+
+// MinMax bounds the limit, min is also the limit used while probing the rtt
+func (b *bbrBuilder) MinMax(min, max float64) *bbrBuilder {
+	b.min, b.max = min, max
+	return b
+}
+
+// Gain is applied to the estimated bdp, a gain above 1 leaves room for a small queue
+func (b *bbrBuilder) Gain(gain float64) *bbrBuilder {
+	b.gain = gain
+	return b
+}
+
+// MinRttWindow is how long a min rtt is trusted before the rtt is probed again
+func (b *bbrBuilder) MinRttWindow(window time.Duration) *bbrBuilder {
+	b.minRttWindow = window
+	return b
+}
+
+// RateWindow is how long a max delivery rate is remembered
+func (b *bbrBuilder) RateWindow(window time.Duration) *bbrBuilder {
+	b.rateWindow = window
+	return b
+}
+
+func (b *bbrBuilder) ProbeRttDuration(duration time.Duration) *bbrBuilder {
+	b.probeRttDuration = duration
+	return b
+}
+
+func (b *bbrBuilder) validate() error {
+	switch {
+	case b.min < 1 || b.min > b.max:
+		return fmt.Errorf("bbr: min %v and max %v must satisfy 1 <= min <= max", b.min, b.max)
+	case b.initial < b.min || b.initial > b.max:
+		return fmt.Errorf("bbr: initial limit %v must be in [%v, %v]", b.initial, b.min, b.max)
+	case b.gain < 1:
+		return fmt.Errorf("bbr: gain %v must be at least 1", b.gain)
+	case b.minRttWindow <= 0 || b.rateWindow <= 0 || b.probeRttDuration <= 0:
+		return fmt.Errorf("bbr: windows %v, %v and probe rtt duration %v must be positive",
+			b.minRttWindow, b.rateWindow, b.probeRttDuration)
+	}
+
+	return nil
+}
+
+func (b *bbrBuilder) Build() limits.Limit {
+	if err := b.validate(); err != nil {
+		panic(err)
+	}
+
+	return &BBRLimit{
+		baseLimit:        baseLimit{id: "bbr", limit: int32(b.initial)},
+		minLimit:         b.min,
+		maxLimit:         b.max,
+		gain:             b.gain,
+		minRttWindow:     b.minRttWindow,
+		probeRttDuration: b.probeRttDuration,
+		minRtt:           window.NewMinFilter(b.minRttWindow),
+		maxRate:          window.NewMaxFilter(b.rateWindow),
+	}
+}
+
+// BBRLimit estimates the bottleneck delivery rate and the min rtt, the limit is their
+// product(the bdp) times a gain. The delivery rate is measured per round, a round lasts
+// one min rtt, so samples must be fed per request rather than through a WindowedLimit.
+type BBRLimit struct {
+	baseLimit
+
+	mu sync.Mutex
+
+	minLimit, maxLimit float64
+
+	gain float64
+
+	phase BBRPhase
+
+	// min rtt in nanos and max delivery rate in completions per second
+	minRtt, maxRate *window.MinMaxFilter
+
+	minRttStamp      time.Time
+	minRttWindow     time.Duration
+	probeRttDuration time.Duration
+	probeRttDone     time.Time
+
+	roundStart time.Time
+	delivered  int
+
+	fullBw      int64
+	fullBwCount int
+	filledPipe  bool
+
+	cycleIndex int
+}
+
+// Phase returns the current probing phase
+func (bl *BBRLimit) Phase() BBRPhase {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	return bl.phase
+}
+
+func (bl *BBRLimit) OnSample(ctx context.Context, startTime time.Time, rtt time.Duration, inflight int, didDrop bool) {
+	if rtt <= 0 {
+		return
+	}
+
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	now := startTime.Add(rtt)
+	if bl.roundStart.IsZero() {
+		bl.roundStart = now
+	}
+
+	if !didDrop {
+		bl.delivered++
+		bl.updateMinRtt(now, rtt)
+	}
+
+	if now.Sub(bl.roundStart) >= bl.roundInterval() {
+		bl.endRound(now)
+	}
+
+	bl.updatePhase(now, inflight)
+	bl.setLimit(int(bl.targetLimit()))
+}
+
+func (bl *BBRLimit) updateMinRtt(now time.Time, rtt time.Duration) {
+	// the stamp only moves when the min rtt is confirmed, a stale stamp triggers probe rtt
+	if bl.minRttStamp.IsZero() || int64(rtt) <= bl.minRtt.Get() {
+		bl.minRttStamp = now
+	}
+
+	bl.minRtt.Update(now, int64(rtt))
+}
+
+func (bl *BBRLimit) roundInterval() time.Duration {
+	return time.Duration(math.Max(float64(bbrMinRoundInterval), float64(bl.minRtt.Get())))
+}
+
+func (bl *BBRLimit) endRound(now time.Time) {
+	elapsed := now.Sub(bl.roundStart)
+	rate := int64(float64(bl.delivered) / elapsed.Seconds())
+	bl.maxRate.Update(now, rate)
+	bl.roundStart, bl.delivered = now, 0
+
+	if !bl.filledPipe {
+		if maxRate := bl.maxRate.Get(); float64(maxRate) >= float64(bl.fullBw)*bbrFullBwThreshold {
+			bl.fullBw, bl.fullBwCount = maxRate, 0
+		} else if bl.fullBwCount++; bl.fullBwCount >= bbrFullBwRounds {
+			bl.filledPipe = true
+		}
+	}
+
+	if bl.phase == BBRProbeBW {
+		bl.cycleIndex = (bl.cycleIndex + 1) % len(bbrProbeBWGains)
+	}
+}
+
+func (bl *BBRLimit) updatePhase(now time.Time, inflight int) {
+	switch bl.phase {
+	case BBRStartup:
+		if bl.filledPipe {
+			bl.phase = BBRDrain
+		}
+	case BBRDrain:
+		if float64(inflight) <= bl.bdp() {
+			bl.enterProbeBW()
+		}
+	case BBRProbeRTT:
+		if now.After(bl.probeRttDone) {
+			bl.minRttStamp = now
+			if bl.filledPipe {
+				bl.enterProbeBW()
+			} else {
+				bl.phase = BBRStartup
+			}
+		}
+		return
+	}
+
+	if now.Sub(bl.minRttStamp) > bl.minRttWindow {
+		bl.phase = BBRProbeRTT
+		bl.probeRttDone = now.Add(util.Max(bl.probeRttDuration, bl.roundInterval()))
+	}
+}
+
+func (bl *BBRLimit) enterProbeBW() {
+	bl.phase = BBRProbeBW
+	bl.cycleIndex = 0
+}
+
+// bdp is the number of requests the bottleneck can serve in one min rtt
+func (bl *BBRLimit) bdp() float64 {
+	return float64(bl.maxRate.Get()) * time.Duration(bl.minRtt.Get()).Seconds()
+}
+
+func (bl *BBRLimit) targetLimit() float64 {
+	var phaseGain float64
+	switch bl.phase {
+	case BBRStartup:
+		phaseGain = bbrHighGain
+	case BBRDrain:
+		phaseGain = 1 / bbrHighGain
+	case BBRProbeBW:
+		phaseGain = bbrProbeBWGains[bl.cycleIndex]
+	case BBRProbeRTT:
+		return bl.minLimit
+	}
+
+	bdp := bl.bdp()
+	if bdp == 0 {
+		// no delivery rate yet
+		return float64(bl.GetLimit())
+	}
+
+	return math.Max(bl.minLimit, math.Min(bl.maxLimit, bl.gain*phaseGain*bdp))
+}
@@ -0,0 +1,61 @@
+package limit
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// simulate a saturated server with a bottleneck of capacity requests per second
+// and a base latency, every caller is admitted up to the limit
+func simulateBBR(l *BBRLimit, now time.Time, capacity float64, base time.Duration, duration time.Duration, observe func()) time.Time {
+	tick := time.Millisecond
+	pending := 0.0
+
+	for end := now.Add(duration); now.Before(end); now = now.Add(tick) {
+		inflight := float64(l.GetLimit())
+		rate := math.Min(inflight/base.Seconds(), capacity)
+		rtt := time.Duration(math.Max(float64(base), inflight/capacity*float64(time.Second)))
+
+		for pending += rate * tick.Seconds(); pending >= 1; pending-- {
+			l.OnSample(context.Background(), now.Add(-rtt), rtt, int(inflight), false)
+		}
+
+		if observe != nil {
+			observe()
+		}
+	}
+
+	return now
+}
+
+func TestBBRLimit(t *testing.T) {
+	l := NewBBRBuilder().Initial(4).MinMax(4, 1000).Build().(*BBRLimit)
+
+	phases := map[BBRPhase]bool{}
+	now := simulateBBR(l, time.Unix(0, 0), 1000, 10*time.Millisecond, 30*time.Second, func() {
+		phases[l.Phase()] = true
+	})
+
+	for _, phase := range []BBRPhase{BBRStartup, BBRDrain, BBRProbeBW, BBRProbeRTT} {
+		if !phases[phase] {
+			t.Errorf("phase %v never entered", phase)
+		}
+	}
+
+	// bdp is 1000/s * 10ms = 10 requests, with the default gain of 2 the limit
+	// cycles around 20 while probing bandwidth
+	var min, max int = math.MaxInt, 0
+	simulateBBR(l, now, 1000, 10*time.Millisecond, time.Second, func() {
+		if l.Phase() != BBRProbeBW {
+			return
+		}
+
+		min, max = int(math.Min(float64(min), float64(l.GetLimit()))), int(math.Max(float64(max), float64(l.GetLimit())))
+	})
+
+	if min < 14 || max > 26 {
+		t.Fatalf("expected the limit to stay around 20, got [%d, %d]", min, max)
+	}
+}
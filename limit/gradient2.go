@@ -2,7 +2,9 @@ package limit
 
 import (
 	"context"
+	"fmt"
 	"math"
+	"sync"
 	"time"
 
 	"github.com/xtracker/limits"
@@ -10,6 +12,7 @@ import (
 )
 
 type gradientBuilder struct {
+	id                string
 	initial, min, max float64
 	longWindow        int
 	smooth            float64
@@ -19,6 +22,7 @@ type gradientBuilder struct {
 
 func NewGradientBuilder() *gradientBuilder {
 	return &gradientBuilder{
+		id:         "gradient2",
 		initial:    20,
 		min:        1,
 		max:        200,
@@ -50,9 +54,62 @@ func (g *gradientBuilder) MinMax(min, max float64) *gradientBuilder {
 	return g
 }
 
+// ID names the limit, it is returned by String()
+func (g *gradientBuilder) ID(id string) *gradientBuilder {
+	g.id = id
+	return g
+}
+
+// LongWindow is the number of samples the long term, baseline rtt is averaged over
+func (g *gradientBuilder) LongWindow(window int) *gradientBuilder {
+	g.longWindow = window
+	return g
+}
+
+// Smoothing controls how fast the estimated limit moves towards the new limit, 1.0 means no smoothing
+func (g *gradientBuilder) Smoothing(smoothing float64) *gradientBuilder {
+	g.smooth = smoothing
+	return g
+}
+
+// Tolerance is the ratio of short rtt to long rtt that is tolerated before the limit is reduced
+func (g *gradientBuilder) Tolerance(tolerance float64) *gradientBuilder {
+	g.tolerance = tolerance
+	return g
+}
+
+// QueueSize returns the headroom added to the limit given the current limit
+func (g *gradientBuilder) QueueSize(queueSize func(int) float64) *gradientBuilder {
+	g.queueSize = queueSize
+	return g
+}
+
+func (g *gradientBuilder) validate() error {
+	switch {
+	case g.min < 1 || g.min > g.max:
+		return fmt.Errorf("gradient2: min %v and max %v must satisfy 1 <= min <= max", g.min, g.max)
+	case g.initial < g.min || g.initial > g.max:
+		return fmt.Errorf("gradient2: initial limit %v must be in [%v, %v]", g.initial, g.min, g.max)
+	case g.smooth <= 0 || g.smooth > 1:
+		return fmt.Errorf("gradient2: smoothing %v must be in (0, 1]", g.smooth)
+	case g.tolerance < 1:
+		return fmt.Errorf("gradient2: tolerance %v must be at least 1", g.tolerance)
+	case g.longWindow <= 0:
+		return fmt.Errorf("gradient2: long window %v must be positive", g.longWindow)
+	case g.queueSize == nil:
+		return fmt.Errorf("gradient2: queue size function must not be nil")
+	}
+
+	return nil
+}
+
 func (g *gradientBuilder) Build() limits.Limit {
+	if err := g.validate(); err != nil {
+		panic(err)
+	}
+
 	return &Gradient2Limit{
-		baseLimit:      baseLimit{},
+		baseLimit:      baseLimit{id: g.id, limit: int32(g.initial)},
 		initLimit:      g.initial,
 		minLimit:       g.min,
 		maxLimit:       g.max,
@@ -67,10 +124,12 @@ func (g *gradientBuilder) Build() limits.Limit {
 type Gradient2Limit struct {
 	baseLimit
 
+	// guards the estimation state below, OnSample may be called concurrently
+	mu sync.Mutex
+
 	/**
-	     * Estimated concurrency limit based on our algorithm
-		 * Need volatile
-	*/
+	 * Estimated concurrency limit based on our algorithm
+	 */
 	estimatedLimit float64
 
 	/**
@@ -97,7 +156,9 @@ type Gradient2Limit struct {
 }
 
 func (gl *Gradient2Limit) OnSample(ctx context.Context, startTime time.Time, rtt time.Duration, inflight int, didDrop bool) {
-	defer gl.setLimit(int(gl.estimatedLimit))
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+
 	queueSize := gl.queueSize(int(gl.estimatedLimit))
 	appLimited := inflight < int(gl.estimatedLimit/2.0)
 
@@ -132,4 +193,5 @@ func (gl *Gradient2Limit) OnSample(ctx context.Context, startTime time.Time, rtt
 	newLimit = math.Max(gl.minLimit, math.Min(gl.maxLimit, newLimit))
 
 	gl.estimatedLimit = newLimit
+	gl.setLimit(int(newLimit))
 }
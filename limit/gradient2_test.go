@@ -0,0 +1,57 @@
+package limit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGradientBuilder(t *testing.T) {
+	l := NewGradientBuilder().ID("interactive").Initial(10).MinMax(5, 50).Tolerance(2).Build()
+	if l.String() != "interactive" {
+		t.Fatalf("unexpected id %q", l.String())
+	}
+
+	if l.GetLimit() != 10 {
+		t.Fatalf("expected initial limit 10, got %d", l.GetLimit())
+	}
+
+	cases := map[string]*gradientBuilder{
+		"initial below min": NewGradientBuilder().MinMax(30, 50),
+		"initial above max": NewGradientBuilder().Initial(100).MinMax(1, 50),
+		"zero smoothing":    NewGradientBuilder().Smoothing(0),
+		"large smoothing":   NewGradientBuilder().Smoothing(1.5),
+		"low tolerance":     NewGradientBuilder().Tolerance(0.5),
+		"zero long window":  NewGradientBuilder().LongWindow(0),
+		"nil queue size":    NewGradientBuilder().QueueSize(nil),
+	}
+
+	for name, builder := range cases {
+		if builder.validate() == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestGradient2LimitConcurrentSamples(t *testing.T) {
+	l := NewGradientBuilder().Initial(20).MinMax(1, 200).Build()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				rtt := time.Duration(1+(g+i)%10) * time.Millisecond
+				l.OnSample(context.Background(), time.Now(), rtt, 20+i%200, i%17 == 0)
+				l.GetLimit()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if limit := l.GetLimit(); limit < 1 || limit > 200 {
+		t.Fatalf("limit %d escaped [1, 200]", limit)
+	}
+}
@@ -1,5 +1,7 @@
 package measurement
 
+import "sync"
+
 func NewAverageMeasurement(window, warmupWindow int) *ExpAvgMeasurement {
 	return &ExpAvgMeasurement{
 		window:       window,
@@ -10,7 +12,9 @@ func NewAverageMeasurement(window, warmupWindow int) *ExpAvgMeasurement {
 	}
 }
 
+// ExpAvgMeasurement is safe for concurrent use
 type ExpAvgMeasurement struct {
+	mu           sync.Mutex
 	value        float64
 	sum          float64
 	window       int
@@ -19,6 +23,9 @@ type ExpAvgMeasurement struct {
 }
 
 func (m *ExpAvgMeasurement) Add(sample Number) Number {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.count < m.warmupWindow {
 		m.count = m.count + 1
 		m.sum = m.sum + sample.Float64()
@@ -32,15 +39,25 @@ func (m *ExpAvgMeasurement) Add(sample Number) Number {
 }
 
 func (m *ExpAvgMeasurement) Get() Number {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	return Float64Number(m.value)
 }
 
 func (m *ExpAvgMeasurement) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.value = 0.0
 	m.count = 0
 	m.sum = 0
 }
 
+// Update applies op atomically, op must not call back into the measurement
 func (m *ExpAvgMeasurement) Update(op func(Number) Number) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.value = op(Float64Number(m.value)).Float64()
 }
@@ -0,0 +1,31 @@
+package measurement
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestExpAvgMeasurementConcurrent(t *testing.T) {
+	m := NewAverageMeasurement(100, 10)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Add(Int64Number(100))
+				m.Update(func(current Number) Number {
+					return Float64Number(current.Float64())
+				})
+				m.Get()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v := m.Get().Float64(); math.Abs(v-100) > 1e-9 {
+		t.Fatalf("expected average of constant samples to be 100, got %v", v)
+	}
+}
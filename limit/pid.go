@@ -0,0 +1,137 @@
+package limit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+type pidBuilder struct {
+	target            time.Duration
+	initial, min, max float64
+	kp, ki, kd        float64
+}
+
+// NewPIDBuilder builds a limit that keeps the sampled rtt around target,
+// use it behind a WindowedLimit with a percentile window to target a tail latency
+func NewPIDBuilder(target time.Duration) *pidBuilder {
+	return &pidBuilder{
+		target:  target,
+		initial: 20,
+		min:     1,
+		max:     200,
+		kp:      10,
+		ki:      2,
+		kd:      0,
+	}
+}
+
+func (p *pidBuilder) Initial(initial float64) *pidBuilder {
+	p.initial = initial
+	return p
+}
+
+func (p *pidBuilder) MinMax(min, max float64) *pidBuilder {
+	p.min, p.max = min, max
+	return p
+}
+
+// Gains of the controller, expressed in requests per unit of relative latency error,
+// the error is (target-rtt)/target and it is clamped to [-1, 1]
+func (p *pidBuilder) Gains(kp, ki, kd float64) *pidBuilder {
+	p.kp, p.ki, p.kd = kp, ki, kd
+	return p
+}
+
+func (p *pidBuilder) validate() error {
+	switch {
+	case p.target <= 0:
+		return fmt.Errorf("pid: target latency %v must be positive", p.target)
+	case p.min < 1 || p.min > p.max:
+		return fmt.Errorf("pid: min %v and max %v must satisfy 1 <= min <= max", p.min, p.max)
+	case p.initial < p.min || p.initial > p.max:
+		return fmt.Errorf("pid: initial limit %v must be in [%v, %v]", p.initial, p.min, p.max)
+	case p.kp < 0 || p.ki < 0 || p.kd < 0:
+		return fmt.Errorf("pid: gains %v, %v, %v must not be negative", p.kp, p.ki, p.kd)
+	case p.kp == 0 && p.ki == 0:
+		return fmt.Errorf("pid: at least one of kp and ki must be positive")
+	}
+
+	return nil
+}
+
+func (p *pidBuilder) Build() limits.Limit {
+	if err := p.validate(); err != nil {
+		panic(err)
+	}
+
+	return &PIDLimit{
+		baseLimit:      baseLimit{id: "pid", limit: int32(p.initial)},
+		target:         p.target,
+		initLimit:      p.initial,
+		minLimit:       p.min,
+		maxLimit:       p.max,
+		estimatedLimit: p.initial,
+		kp:             p.kp,
+		ki:             p.ki,
+		kd:             p.kd,
+	}
+}
+
+// PIDLimit adjusts the limit with a proportional-integral-derivative controller on the
+// relative error between the sampled rtt and a target latency. The controller advances
+// one step per sample, so the outcome only depends on the sequence of samples.
+type PIDLimit struct {
+	baseLimit
+
+	mu sync.Mutex
+
+	target time.Duration
+
+	initLimit, minLimit, maxLimit float64
+
+	estimatedLimit float64
+
+	kp, ki, kd float64
+
+	integral  float64
+	lastError float64
+	hasError  bool
+}
+
+func (pl *PIDLimit) OnSample(ctx context.Context, startTime time.Time, rtt time.Duration, inflight int, didDrop bool) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	e := -1.0
+	if !didDrop {
+		e = math.Max(-1, math.Min(1, float64(pl.target-rtt)/float64(pl.target)))
+	}
+
+	derivative := 0.0
+	if pl.hasError {
+		derivative = e - pl.lastError
+	}
+	pl.lastError, pl.hasError = e, true
+
+	integral := pl.integral + e
+	raw := pl.initLimit + pl.kp*e + pl.ki*integral + pl.kd*derivative
+	newLimit := math.Max(pl.minLimit, math.Min(pl.maxLimit, raw))
+
+	// anti-windup: stop integrating while the output is saturated in the direction of the error,
+	// and never let the integral term alone exceed the output range
+	if newLimit == raw || (raw > pl.maxLimit) != (e > 0) {
+		pl.integral = integral
+	}
+
+	if pl.ki > 0 {
+		pl.integral = math.Max((pl.minLimit-pl.initLimit)/pl.ki, math.Min((pl.maxLimit-pl.initLimit)/pl.ki, pl.integral))
+	}
+
+	pl.estimatedLimit = newLimit
+	pl.setLimit(int(newLimit))
+}
@@ -0,0 +1,99 @@
+package limit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+func feed(l limits.Limit, n int, rtt time.Duration, dropped bool) {
+	for i := 0; i < n; i++ {
+		l.OnSample(context.Background(), time.Time{}, rtt, 0, dropped)
+	}
+}
+
+func TestPIDLimitBounds(t *testing.T) {
+	l := NewPIDBuilder(100*time.Millisecond).Initial(20).MinMax(5, 50).Build()
+
+	feed(l, 100, 300*time.Millisecond, false)
+	if l.GetLimit() != 5 {
+		t.Fatalf("expected limit to reach min 5 when latency is above target, got %d", l.GetLimit())
+	}
+
+	feed(l, 100, 10*time.Millisecond, false)
+	if l.GetLimit() != 50 {
+		t.Fatalf("expected limit to reach max 50 when latency is below target, got %d", l.GetLimit())
+	}
+
+	feed(l, 100, time.Millisecond, true)
+	if l.GetLimit() != 5 {
+		t.Fatalf("expected drops to push the limit to min 5, got %d", l.GetLimit())
+	}
+}
+
+func TestPIDLimitAntiWindup(t *testing.T) {
+	l := NewPIDBuilder(100*time.Millisecond).Initial(20).MinMax(1, 100).Build()
+
+	// a long period under the target saturates the output at max
+	feed(l, 10000, 10*time.Millisecond, false)
+	if l.GetLimit() != 100 {
+		t.Fatalf("expected limit to saturate at 100, got %d", l.GetLimit())
+	}
+
+	// without anti-windup the accumulated integral would keep the limit at max for thousands of samples
+	steps := 0
+	for ; l.GetLimit() >= 100 && steps < 100; steps++ {
+		feed(l, 1, 200*time.Millisecond, false)
+	}
+
+	if steps > 5 {
+		t.Fatalf("limit took %d samples to leave saturation", steps)
+	}
+}
+
+func TestPIDLimitConverges(t *testing.T) {
+	target := 100 * time.Millisecond
+	l := NewPIDBuilder(target).Initial(10).MinMax(1, 200).Gains(5, 1, 1).Build()
+
+	// synthetic system: latency grows linearly with concurrency, 2.5ms per request,
+	// so the target is reached with 40 requests in flight
+	rtt := func(limit int) time.Duration {
+		return time.Duration(limit) * 2500 * time.Microsecond
+	}
+
+	for i := 0; i < 500; i++ {
+		l.OnSample(context.Background(), time.Time{}, rtt(l.GetLimit()), l.GetLimit(), false)
+	}
+
+	if limit := l.GetLimit(); limit < 38 || limit > 42 {
+		t.Fatalf("expected limit to settle around 40, got %d", limit)
+	}
+
+	// the outcome only depends on the samples
+	again := NewPIDBuilder(target).Initial(10).MinMax(1, 200).Gains(5, 1, 1).Build()
+	for i := 0; i < 500; i++ {
+		again.OnSample(context.Background(), time.Time{}, rtt(again.GetLimit()), again.GetLimit(), false)
+	}
+
+	if again.GetLimit() != l.GetLimit() {
+		t.Fatalf("expected deterministic result, got %d and %d", l.GetLimit(), again.GetLimit())
+	}
+}
+
+func TestPIDBuilderValidate(t *testing.T) {
+	cases := map[string]*pidBuilder{
+		"zero target":      NewPIDBuilder(0),
+		"initial above":    NewPIDBuilder(time.Second).Initial(300),
+		"min above max":    NewPIDBuilder(time.Second).MinMax(10, 5),
+		"negative gain":    NewPIDBuilder(time.Second).Gains(-1, 1, 0),
+		"derivative alone": NewPIDBuilder(time.Second).Gains(0, 0, 1),
+	}
+
+	for name, builder := range cases {
+		if builder.validate() == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package limit
+
+import (
+	"context"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+var (
+	_ limits.Limit = (*SettableLimit)(nil)
+)
+
+func NewSettableLimit(initial int) *SettableLimit {
+	return &SettableLimit{
+		baseLimit: baseLimit{id: "settable", limit: int32(initial)},
+	}
+}
+
+// SettableLimit ignores samples, its value is only changed through SetLimit,
+// which makes it suitable as a manual override
+type SettableLimit struct {
+	baseLimit
+}
+
+// SetLimit updates the limit and notifies every listener if the value changed
+func (s *SettableLimit) SetLimit(limit int) {
+	s.setLimit(limit)
+}
+
+func (*SettableLimit) OnSample(context.Context, time.Time, time.Duration, int, bool) {
+
+}
@@ -0,0 +1,50 @@
+package limit
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSettableLimit(t *testing.T) {
+	l := NewSettableLimit(10)
+
+	var notified []int
+	l.NotifyChange(func(limit int) {
+		notified = append(notified, limit)
+	})
+
+	l.SetLimit(10)
+	l.SetLimit(20)
+	l.SetLimit(5)
+
+	if l.GetLimit() != 5 {
+		t.Fatalf("expected limit 5, got %d", l.GetLimit())
+	}
+
+	if len(notified) != 2 || notified[0] != 20 || notified[1] != 5 {
+		t.Fatalf("unexpected notifications %v", notified)
+	}
+}
+
+func TestSettableLimitConcurrentSet(t *testing.T) {
+	l := NewSettableLimit(0)
+
+	last := 0
+	l.NotifyChange(func(limit int) {
+		last = limit
+	})
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l.SetLimit(i)
+		}(i)
+	}
+	wg.Wait()
+
+	if last != l.GetLimit() {
+		t.Fatalf("last notification %d does not match limit %d", last, l.GetLimit())
+	}
+}
@@ -0,0 +1,174 @@
+package limit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+var (
+	_ limits.Limit = (*TracingLimit)(nil)
+	_ TraceSink    = (*RingSink)(nil)
+)
+
+type TraceKind int
+
+const (
+	TraceSample      TraceKind = iota // OnSample was called
+	TraceLimitChange                  // the limit changed
+)
+
+func (k TraceKind) String() string {
+	switch k {
+	case TraceSample:
+		return "sample"
+	case TraceLimitChange:
+		return "limit_change"
+	default:
+		return "unknown"
+	}
+}
+
+// Trace is a single record reported by TracingLimit, sample fields are only set for TraceSample
+type Trace struct {
+	Kind TraceKind
+	ID   string
+	Time time.Time
+
+	StartTime time.Time
+	Rtt       time.Duration
+	Inflight  int
+	Dropped   bool
+
+	// Limit is the limit when the sample is taken, or the new limit of a change
+	Limit int
+	// Previous is the limit before a change
+	Previous int
+}
+
+// TraceSink receives the traces of a TracingLimit, it may be called concurrently
+type TraceSink interface {
+	Record(Trace)
+}
+
+// NewTracingLimit reports every sample and limit change of delegate to sink.
+// Wrap the delegate of a WindowedLimit to trace aggregated windows instead of raw samples.
+func NewTracingLimit(delegate limits.Limit, sink TraceSink) *TracingLimit {
+	tl := &TracingLimit{
+		Limit: delegate,
+		sink:  sink,
+		last:  int32(delegate.GetLimit()),
+	}
+
+	delegate.NotifyChange(tl.onChange)
+	return tl
+}
+
+type TracingLimit struct {
+	limits.Limit
+	sink TraceSink
+	last int32
+}
+
+func (tl *TracingLimit) OnSample(ctx context.Context, startTime time.Time, rtt time.Duration, inflight int, dropped bool) {
+	tl.sink.Record(Trace{
+		Kind:      TraceSample,
+		ID:        tl.Limit.String(),
+		Time:      time.Now(),
+		StartTime: startTime,
+		Rtt:       rtt,
+		Inflight:  inflight,
+		Dropped:   dropped,
+		Limit:     tl.Limit.GetLimit(),
+	})
+
+	tl.Limit.OnSample(ctx, startTime, rtt, inflight, dropped)
+}
+
+func (tl *TracingLimit) onChange(limit int) {
+	previous := atomic.SwapInt32(&tl.last, int32(limit))
+	tl.sink.Record(Trace{
+		Kind:     TraceLimitChange,
+		ID:       tl.Limit.String(),
+		Time:     time.Now(),
+		Limit:    limit,
+		Previous: int(previous),
+	})
+}
+
+// NewSlogSink logs samples at debug level and limit changes at info level,
+// the default logger is used if logger is nil
+func NewSlogSink(logger *slog.Logger) TraceSink {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &slogSink{logger: logger}
+}
+
+type slogSink struct {
+	logger *slog.Logger
+}
+
+func (s *slogSink) Record(t Trace) {
+	switch t.Kind {
+	case TraceSample:
+		s.logger.LogAttrs(context.Background(), slog.LevelDebug, "limit sample",
+			slog.String("id", t.ID),
+			slog.Time("start", t.StartTime),
+			slog.Duration("rtt", t.Rtt),
+			slog.Int("inflight", t.Inflight),
+			slog.Bool("dropped", t.Dropped),
+			slog.Int("limit", t.Limit))
+	case TraceLimitChange:
+		s.logger.LogAttrs(context.Background(), slog.LevelInfo, "limit changed",
+			slog.String("id", t.ID),
+			slog.Int("previous", t.Previous),
+			slog.Int("limit", t.Limit))
+	}
+}
+
+// NewRingSink keeps the latest size traces in memory
+func NewRingSink(size int) *RingSink {
+	if size <= 0 {
+		panic("ring sink size must be positive")
+	}
+
+	return &RingSink{
+		traces: make([]Trace, size),
+	}
+}
+
+type RingSink struct {
+	sync.Mutex
+	traces []Trace
+	next   int
+	full   bool
+}
+
+func (r *RingSink) Record(t Trace) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.traces[r.next] = t
+	r.next = (r.next + 1) % len(r.traces)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Traces returns the retained traces, oldest first
+func (r *RingSink) Traces() []Trace {
+	r.Lock()
+	defer r.Unlock()
+
+	if !r.full {
+		return append([]Trace(nil), r.traces[:r.next]...)
+	}
+
+	return append(append([]Trace(nil), r.traces[r.next:]...), r.traces[:r.next]...)
+}
@@ -0,0 +1,39 @@
+package limit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTracingLimit(t *testing.T) {
+	sink := NewRingSink(3)
+	l := NewTracingLimit(NewAIMDBuilder().Initial(20).MinMax(10, 100).Build(), sink)
+
+	ctx := context.Background()
+	l.OnSample(ctx, time.Now(), time.Millisecond, 1, false)
+	l.OnSample(ctx, time.Now(), time.Millisecond, 20, true)
+
+	traces := sink.Traces()
+	if len(traces) != 3 {
+		t.Fatalf("expected 3 traces, got %d", len(traces))
+	}
+
+	if traces[0].Kind != TraceSample || traces[0].Dropped || traces[0].Limit != 20 {
+		t.Errorf("unexpected first trace %+v", traces[0])
+	}
+
+	if traces[1].Kind != TraceSample || !traces[1].Dropped || traces[1].Inflight != 20 {
+		t.Errorf("unexpected second trace %+v", traces[1])
+	}
+
+	if traces[2].Kind != TraceLimitChange || traces[2].Previous != 20 || traces[2].Limit != 18 || traces[2].ID != "aimd" {
+		t.Errorf("unexpected change trace %+v", traces[2])
+	}
+
+	// the ring only retains the latest traces
+	l.OnSample(ctx, time.Now(), 2*time.Millisecond, 1, false)
+	if traces := sink.Traces(); len(traces) != 3 || traces[2].Rtt != 2*time.Millisecond {
+		t.Errorf("expected oldest trace to be overwritten, got %+v", traces)
+	}
+}
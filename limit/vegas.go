@@ -0,0 +1,232 @@
+package limit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+// log10Root is the default shape of the vegas thresholds, it grows slowly
+// with the limit so that large limits are not too sensitive to queueing
+func log10Root(limit int) int {
+	return int(math.Max(1, math.Log10(float64(limit))))
+}
+
+type vegasBuilder struct {
+	initial, max    float64
+	smoothing       float64
+	probeMultiplier int
+	alpha           func(int) int
+	beta            func(int) int
+	threshold       func(int) int
+	increase        func(float64) float64
+	decrease        func(float64) float64
+}
+
+func NewVegasBuilder() *vegasBuilder {
+	return &vegasBuilder{
+		initial:         20,
+		max:             1000,
+		smoothing:       1.0,
+		probeMultiplier: 30,
+		alpha: func(limit int) int {
+			return 3 * log10Root(limit)
+		},
+		beta: func(limit int) int {
+			return 6 * log10Root(limit)
+		},
+		threshold: log10Root,
+		increase: func(limit float64) float64 {
+			return limit + float64(log10Root(int(limit)))
+		},
+		decrease: func(limit float64) float64 {
+			return limit - float64(log10Root(int(limit)))
+		},
+	}
+}
+
+func (v *vegasBuilder) Initial(initial float64) *vegasBuilder {
+	v.initial = initial
+	return v
+}
+
+func (v *vegasBuilder) MaxConcurrency(max float64) *vegasBuilder {
+	v.max = max
+	return v
+}
+
+// Smoothing controls how fast the estimated limit moves towards the new limit, 1.0 means no smoothing
+func (v *vegasBuilder) Smoothing(smoothing float64) *vegasBuilder {
+	v.smoothing = smoothing
+	return v
+}
+
+// ProbeMultiplier controls how often the no-load rtt is reset,
+// a probe happens roughly every multiplier*limit samples
+func (v *vegasBuilder) ProbeMultiplier(multiplier int) *vegasBuilder {
+	v.probeMultiplier = multiplier
+	return v
+}
+
+// Alpha is the queue size under which the limit is increased
+func (v *vegasBuilder) Alpha(alpha func(int) int) *vegasBuilder {
+	v.alpha = alpha
+	return v
+}
+
+// Beta is the queue size above which the limit is decreased
+func (v *vegasBuilder) Beta(beta func(int) int) *vegasBuilder {
+	v.beta = beta
+	return v
+}
+
+// Threshold is the queue size under which the limit is aggressively increased by beta
+func (v *vegasBuilder) Threshold(threshold func(int) int) *vegasBuilder {
+	v.threshold = threshold
+	return v
+}
+
+func (v *vegasBuilder) Increase(increase func(float64) float64) *vegasBuilder {
+	v.increase = increase
+	return v
+}
+
+func (v *vegasBuilder) Decrease(decrease func(float64) float64) *vegasBuilder {
+	v.decrease = decrease
+	return v
+}
+
+func (v *vegasBuilder) validate() error {
+	switch {
+	case v.max < 1:
+		return fmt.Errorf("vegas: max concurrency %v must be at least 1", v.max)
+	case v.initial < 1 || v.initial > v.max:
+		return fmt.Errorf("vegas: initial limit %v must be in [1, %v]", v.initial, v.max)
+	case v.smoothing <= 0 || v.smoothing > 1:
+		return fmt.Errorf("vegas: smoothing %v must be in (0, 1]", v.smoothing)
+	case v.probeMultiplier <= 0:
+		return fmt.Errorf("vegas: probe multiplier %v must be positive", v.probeMultiplier)
+	case v.alpha == nil || v.beta == nil || v.threshold == nil || v.increase == nil || v.decrease == nil:
+		return fmt.Errorf("vegas: alpha, beta, threshold, increase and decrease must not be nil")
+	}
+
+	return nil
+}
+
+func (v *vegasBuilder) Build() limits.Limit {
+	if err := v.validate(); err != nil {
+		panic(err)
+	}
+
+	vl := &VegasLimit{
+		baseLimit:       baseLimit{id: "vegas", limit: int32(v.initial)},
+		estimatedLimit:  v.initial,
+		maxLimit:        v.max,
+		smoothing:       v.smoothing,
+		probeMultiplier: v.probeMultiplier,
+		alpha:           v.alpha,
+		beta:            v.beta,
+		threshold:       v.threshold,
+		increase:        v.increase,
+		decrease:        v.decrease,
+		rnd:             rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	vl.resetProbeJitter()
+
+	return vl
+}
+
+// VegasLimit is a delay based limit inspired by TCP vegas. The limit is adjusted
+// according to the estimated queue size, limit*(1-rttNoLoad/rtt)
+type VegasLimit struct {
+	baseLimit
+
+	mu sync.Mutex
+
+	estimatedLimit float64
+
+	maxLimit float64
+
+	/**
+	 * Lowest observed rtt, it is reset periodically by probing to adapt to baseline latency changes
+	 */
+	rttNoLoad time.Duration
+
+	smoothing float64
+
+	probeMultiplier int
+	probeCount      int
+	probeJitter     float64
+	rnd             *rand.Rand
+
+	alpha, beta, threshold func(int) int
+
+	increase, decrease func(float64) float64
+}
+
+func (vl *VegasLimit) resetProbeJitter() {
+	vl.probeJitter = 0.5 + vl.rnd.Float64()*0.5
+}
+
+func (vl *VegasLimit) shouldProbe() bool {
+	return vl.probeJitter*float64(vl.probeMultiplier)*vl.estimatedLimit <= float64(vl.probeCount)
+}
+
+func (vl *VegasLimit) OnSample(ctx context.Context, startTime time.Time, rtt time.Duration, inflight int, didDrop bool) {
+	if rtt <= 0 {
+		return
+	}
+
+	// the limit is published under lock so that concurrent samples can't reorder it
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+
+	if newLimit, changed := vl.update(rtt, inflight, didDrop); changed {
+		vl.setLimit(newLimit)
+	}
+}
+
+func (vl *VegasLimit) update(rtt time.Duration, inflight int, didDrop bool) (int, bool) {
+	vl.probeCount++
+	if vl.shouldProbe() {
+		vl.resetProbeJitter()
+		vl.probeCount = 0
+		vl.rttNoLoad = rtt
+		return 0, false
+	}
+
+	if vl.rttNoLoad == 0 || rtt < vl.rttNoLoad {
+		vl.rttNoLoad = rtt
+		return 0, false
+	}
+
+	current := int(vl.estimatedLimit)
+	queueSize := int(math.Ceil(vl.estimatedLimit * (1 - float64(vl.rttNoLoad)/float64(rtt))))
+
+	var newLimit float64
+	switch {
+	case didDrop:
+		newLimit = vl.decrease(vl.estimatedLimit)
+	case inflight*2 < current:
+		// app limited, don't grow the limit
+		return 0, false
+	case queueSize <= vl.threshold(current):
+		newLimit = vl.estimatedLimit + float64(vl.beta(current))
+	case queueSize < vl.alpha(current):
+		newLimit = vl.increase(vl.estimatedLimit)
+	case queueSize > vl.beta(current):
+		newLimit = vl.decrease(vl.estimatedLimit)
+	default:
+		return 0, false
+	}
+
+	newLimit = math.Max(1, math.Min(vl.maxLimit, newLimit))
+	vl.estimatedLimit = (1-vl.smoothing)*vl.estimatedLimit + vl.smoothing*newLimit
+
+	return int(vl.estimatedLimit), true
+}
@@ -0,0 +1,102 @@
+package limit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+func feedOne(l limits.Limit, rtt time.Duration, inflight int, dropped bool) {
+	l.OnSample(context.Background(), time.Time{}, rtt, inflight, dropped)
+}
+
+// newVegas returns a vegas limit of 20 that does not probe, with alpha 3, beta 6 and threshold 1,
+// its no load rtt is 90ms
+func newVegas(b *vegasBuilder) limits.Limit {
+	l := b.Initial(20).ProbeMultiplier(1000).Build()
+	feedOne(l, 90*time.Millisecond, 20, false)
+	return l
+}
+
+func TestVegasLimitQueueSize(t *testing.T) {
+	cases := []struct {
+		name     string
+		rtt      time.Duration
+		inflight int
+		dropped  bool
+		expected int
+	}{
+		{"below threshold grows by beta", 90 * time.Millisecond, 20, false, 26},
+		{"below alpha increases", 100 * time.Millisecond, 20, false, 21},           // queue 2
+		{"between alpha and beta holds", 112500 * time.Microsecond, 20, false, 20}, // queue 4
+		{"above beta decreases", 200 * time.Millisecond, 20, false, 19},            // queue 11
+		{"drop decreases", 90 * time.Millisecond, 20, true, 19},
+		{"app limited holds", 90 * time.Millisecond, 5, false, 20},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := newVegas(NewVegasBuilder())
+			if l.GetLimit() != 20 {
+				t.Fatalf("expected the first sample to only set the no load rtt, got %d", l.GetLimit())
+			}
+
+			feedOne(l, c.rtt, c.inflight, c.dropped)
+			if l.GetLimit() != c.expected {
+				t.Fatalf("expected limit %d, got %d", c.expected, l.GetLimit())
+			}
+		})
+	}
+}
+
+func TestVegasLimitSmoothingAndMax(t *testing.T) {
+	l := newVegas(NewVegasBuilder().Smoothing(0.5))
+	feedOne(l, 90*time.Millisecond, 20, false)
+	if l.GetLimit() != 23 {
+		t.Fatalf("expected half of the step to 26, got %d", l.GetLimit())
+	}
+
+	l = newVegas(NewVegasBuilder().MaxConcurrency(22))
+	feedOne(l, 90*time.Millisecond, 20, false)
+	if l.GetLimit() != 22 {
+		t.Fatalf("expected the limit to be clamped at 22, got %d", l.GetLimit())
+	}
+}
+
+func TestVegasLimitProbe(t *testing.T) {
+	l := NewVegasBuilder().Initial(10).ProbeMultiplier(1).Build().(*VegasLimit)
+	feedOne(l, 10*time.Millisecond, 10, false)
+
+	// the probe happens within multiplier*limit samples, and resets the no load rtt
+	// to the current rtt even though it is higher
+	for i := 0; i < 10 && l.rttNoLoad != 50*time.Millisecond; i++ {
+		feedOne(l, 50*time.Millisecond, 10, false)
+	}
+
+	if l.rttNoLoad != 50*time.Millisecond {
+		t.Fatalf("expected the probe to reset the no load rtt to 50ms, got %v", l.rttNoLoad)
+	}
+}
+
+func TestVegasBuilderValidate(t *testing.T) {
+	cases := map[string]*vegasBuilder{
+		"max":        NewVegasBuilder().MaxConcurrency(0),
+		"initial":    NewVegasBuilder().Initial(2000),
+		"smoothing":  NewVegasBuilder().Smoothing(0),
+		"multiplier": NewVegasBuilder().ProbeMultiplier(0),
+		"alpha":      NewVegasBuilder().Alpha(nil),
+	}
+
+	for name, b := range cases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected Build to panic")
+				}
+			}()
+			b.Build()
+		})
+	}
+}
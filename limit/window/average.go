@@ -36,3 +36,8 @@ func (a *AverageSampleWindow) GetTrackedRttNanos() time.Duration {
 func (a *AverageSampleWindow) SnapShot() SampleWindow {
 	return a
 }
+
+func (a *AverageSampleWindow) Reset() {
+	a.base.Reset()
+	a.sumRtt = 0
+}
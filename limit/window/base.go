@@ -21,6 +21,7 @@ func (w *base) AddSample(rtt time.Duration, inflight int, dropped bool) {
 		w.dropped++
 	}
 
+	w.maxInFlight = util.Max(inflight, w.maxInFlight)
 	w.sampleCount++
 }
 
@@ -69,7 +69,7 @@ func (r *ring) poll() (dataPoint, bool) {
 
 	nextHead := r.increment(head)
 	dp := r.dps[head]
-	atomic.StoreUint64(&r.tail, nextHead)
+	atomic.StoreUint64(&r.head, nextHead)
 	return dp, true
 }
 
@@ -108,14 +108,31 @@ func (r *ring) snapshot() iterator {
 	}
 }
 
+// number of samples buffered per P between two snapshots, must be power of 2
+const defaultBufferSize = 1024
+
 type DataPoints struct {
 	ring
 }
 
+func newDataPoints(size int) *DataPoints {
+	return &DataPoints{
+		ring: ring{
+			dps:  make([]dataPoint, size),
+			size: uint64(size),
+		},
+	}
+}
+
 func NewBufferedSampleWindow(delegate SampleWindow) SampleWindow {
+	dps := make([]*DataPoints, runtime.GOMAXPROCS(0))
+	for i := range dps {
+		dps[i] = newDataPoints(defaultBufferSize)
+	}
+
 	return &bufferedSampleWindow{
 		SampleWindow: delegate,
-		dps:          make([]*DataPoints, runtime.GOMAXPROCS(0)),
+		dps:          dps,
 	}
 }
 
@@ -160,7 +177,7 @@ func (bsw *bufferedSampleWindow) GetCandidateRttNanos() time.Duration {
 }
 
 func (bsw *bufferedSampleWindow) GetTrackedRttNanos() time.Duration {
-	return bsw.GetTrackedRttNanos()
+	return bsw.SampleWindow.GetTrackedRttNanos()
 }
 
 func (bsw *bufferedSampleWindow) GetMaxInFlight() int {
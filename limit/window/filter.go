@@ -0,0 +1,85 @@
+package window
+
+import "time"
+
+type filterSample struct {
+	t time.Time
+	v int64
+}
+
+// NewMinFilter tracks the minimum value seen over the last window
+func NewMinFilter(window time.Duration) *MinMaxFilter {
+	return &MinMaxFilter{
+		window: window,
+		better: func(x, y int64) bool { return x <= y },
+	}
+}
+
+// NewMaxFilter tracks the maximum value seen over the last window
+func NewMaxFilter(window time.Duration) *MinMaxFilter {
+	return &MinMaxFilter{
+		window: window,
+		better: func(x, y int64) bool { return x >= y },
+	}
+}
+
+// MinMaxFilter is the windowed min/max filter by Kathleen Nichols used by BBR,
+// it keeps the best, 2nd best and 3rd best values of three sub windows so that
+// an estimate is always available while old extremes expire.
+// It is not safe for concurrent use.
+type MinMaxFilter struct {
+	window      time.Duration
+	better      func(x, y int64) bool
+	samples     [3]filterSample
+	initialized bool
+}
+
+// Get returns the current estimate, 0 if no value was added
+func (f *MinMaxFilter) Get() int64 {
+	return f.samples[0].v
+}
+
+// Reset forgets every value but v
+func (f *MinMaxFilter) Reset(t time.Time, v int64) int64 {
+	s := filterSample{t, v}
+	f.samples[0], f.samples[1], f.samples[2] = s, s, s
+	f.initialized = true
+	return v
+}
+
+// Update adds v observed at t and returns the new estimate, t must not go backwards
+func (f *MinMaxFilter) Update(t time.Time, v int64) int64 {
+	s := filterSample{t, v}
+
+	if !f.initialized || f.better(v, f.samples[0].v) || t.Sub(f.samples[2].t) > f.window {
+		return f.Reset(t, v)
+	}
+
+	if f.better(v, f.samples[1].v) {
+		f.samples[1], f.samples[2] = s, s
+	} else if f.better(v, f.samples[2].v) {
+		f.samples[2] = s
+	}
+
+	return f.subWindowUpdate(s)
+}
+
+// subWindowUpdate expires the best value once it is older than the window,
+// and spreads the 2nd and 3rd best values over the sub windows
+func (f *MinMaxFilter) subWindowUpdate(s filterSample) int64 {
+	dt := s.t.Sub(f.samples[0].t)
+
+	switch {
+	case dt > f.window:
+		f.samples[0], f.samples[1], f.samples[2] = f.samples[1], f.samples[2], s
+		if s.t.Sub(f.samples[0].t) > f.window {
+			f.samples[0], f.samples[1], f.samples[2] = f.samples[1], f.samples[2], s
+		}
+	case f.samples[1].t.Equal(f.samples[0].t) && dt > f.window/4:
+		f.samples[1], f.samples[2] = s, s
+	case f.samples[2].t.Equal(f.samples[1].t) && dt > f.window/2:
+		f.samples[2] = s
+	}
+
+	return f.samples[0].v
+}
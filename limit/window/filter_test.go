@@ -0,0 +1,40 @@
+package window
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaxFilter(t *testing.T) {
+	start := time.Unix(0, 0)
+	f := NewMaxFilter(10 * time.Second)
+
+	f.Update(start, 100)
+	f.Update(start.Add(3*time.Second), 50)
+	if v := f.Update(start.Add(6*time.Second), 70); v != 100 {
+		t.Fatalf("expected max 100 within window, got %d", v)
+	}
+
+	// the max expires after the window, the best of the later samples takes over
+	if v := f.Update(start.Add(11*time.Second), 10); v != 70 {
+		t.Fatalf("expected max 70 after expiry, got %d", v)
+	}
+
+	if v := f.Update(start.Add(12*time.Second), 200); v != 200 {
+		t.Fatalf("expected new max 200, got %d", v)
+	}
+}
+
+func TestMinFilter(t *testing.T) {
+	start := time.Unix(0, 0)
+	f := NewMinFilter(time.Second)
+
+	f.Update(start, 10)
+	if v := f.Update(start.Add(500*time.Millisecond), 20); v != 10 {
+		t.Fatalf("expected min 10 within window, got %d", v)
+	}
+
+	if v := f.Update(start.Add(2*time.Second), 30); v != 30 {
+		t.Fatalf("expected every sample to expire after a window without samples, got %d", v)
+	}
+}
@@ -1 +1,80 @@
-package window
\ No newline at end of file
+package window
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// NewPercentileSampleWindow tracks the given percentile(0, 1] of non-dropped rtts.
+// At most capacity rtts are kept in a window, once it is full they are a uniform
+// sample(reservoir sampling) of every rtt of the window, so late samples count too.
+func NewPercentileSampleWindow(percentile float64, capacity int) SampleWindow {
+	if percentile <= 0 || percentile > 1 {
+		panic("percentile must be in (0, 1]")
+	}
+
+	if capacity <= 0 {
+		panic("capacity must be positive")
+	}
+
+	return &PercentileSampleWindow{
+		base: base{
+			minRtt: time.Hour,
+		},
+		percentile: percentile,
+		rtts:       make([]time.Duration, 0, capacity),
+		rnd:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+type PercentileSampleWindow struct {
+	base
+	percentile float64
+	rtts       []time.Duration
+	seen       int // non-dropped rtts of the window
+	rnd        *rand.Rand
+}
+
+func (p *PercentileSampleWindow) AddSample(rtt time.Duration, inflight int, dropped bool) {
+	p.base.AddSample(rtt, inflight, dropped)
+
+	if dropped {
+		return
+	}
+
+	p.seen++
+	if len(p.rtts) < cap(p.rtts) {
+		p.rtts = append(p.rtts, rtt)
+	} else if i := p.rnd.Intn(p.seen); i < len(p.rtts) {
+		p.rtts[i] = rtt
+	}
+}
+
+func (p *PercentileSampleWindow) GetTrackedRttNanos() time.Duration {
+	if len(p.rtts) == 0 {
+		return 0
+	}
+
+	sort.Slice(p.rtts, func(i, j int) bool {
+		return p.rtts[i] < p.rtts[j]
+	})
+
+	index := int(math.Ceil(p.percentile*float64(len(p.rtts)))) - 1
+	if index < 0 {
+		index = 0
+	}
+
+	return p.rtts[index]
+}
+
+func (p *PercentileSampleWindow) SnapShot() SampleWindow {
+	return p
+}
+
+func (p *PercentileSampleWindow) Reset() {
+	p.base.Reset()
+	p.rtts = p.rtts[:0]
+	p.seen = 0
+}
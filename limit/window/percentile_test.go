@@ -0,0 +1,74 @@
+package window
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestPercentileSampleWindow(t *testing.T) {
+	w := NewPercentileSampleWindow(0.9, 100)
+	for i := 1; i <= 10; i++ {
+		w.AddSample(time.Duration(i)*time.Millisecond, i, false)
+	}
+	w.AddSample(time.Second, 11, true)
+
+	if rtt := w.GetTrackedRttNanos(); rtt != 9*time.Millisecond {
+		t.Fatalf("p90 expected 9ms, got %v", rtt)
+	}
+
+	if total, dropped := w.GetSampleCount(); total != 11 || dropped != 1 {
+		t.Fatalf("unexpected sample count %d/%d", total, dropped)
+	}
+
+	w.Reset()
+	if rtt := w.GetTrackedRttNanos(); rtt != 0 {
+		t.Fatalf("expected empty window after reset, got %v", rtt)
+	}
+}
+
+func TestPercentileSampleWindowCapacity(t *testing.T) {
+	w := NewPercentileSampleWindow(0.5, 100)
+	w.(*PercentileSampleWindow).rnd = rand.New(rand.NewSource(1))
+
+	// the window starts fast and slows down, the late samples dominate
+	for i := 0; i < 100; i++ {
+		w.AddSample(time.Millisecond, i, false)
+	}
+	for i := 0; i < 10000; i++ {
+		w.AddSample(100*time.Millisecond, i, false)
+	}
+
+	if rtt := w.GetTrackedRttNanos(); rtt != 100*time.Millisecond {
+		t.Fatalf("p50 expected 100ms, got %v", rtt)
+	}
+
+	if n := len(w.(*PercentileSampleWindow).rtts); n != 100 {
+		t.Fatalf("expected at most 100 tracked rtts, got %d", n)
+	}
+}
+
+func TestBufferedPercentileSampleWindow(t *testing.T) {
+	w := NewBufferedSampleWindow(NewPercentileSampleWindow(0.5, 100))
+	for i := 1; i <= 9; i++ {
+		w.AddSample(time.Duration(i)*time.Millisecond, i, false)
+	}
+
+	if total, _ := w.GetSampleCount(); total != 9 {
+		t.Fatalf("expected 9 buffered samples, got %d", total)
+	}
+
+	snapshot := w.SnapShot()
+	if rtt := snapshot.GetTrackedRttNanos(); rtt != 5*time.Millisecond {
+		t.Fatalf("p50 expected 5ms, got %v", rtt)
+	}
+
+	if total, _ := w.GetSampleCount(); total != 0 {
+		t.Fatalf("expected buffer to be drained by snapshot, got %d", total)
+	}
+
+	w.AddSample(time.Second, 1, false)
+	if rtt := w.SnapShot().GetTrackedRttNanos(); rtt != time.Second {
+		t.Fatalf("expected previous window to be reset, got %v", rtt)
+	}
+}
@@ -2,6 +2,7 @@ package limit
 
 import (
 	"context"
+	"fmt"
 	"sync/atomic"
 	"time"
 
@@ -28,8 +29,73 @@ func NewWindowedLimitBuilder() *windowedLimitBuilder {
 	}
 }
 
+func (w *windowedLimitBuilder) MinWindowTime(min time.Duration) *windowedLimitBuilder {
+	w.minWindowTime = min
+	return w
+}
+
+func (w *windowedLimitBuilder) MaxWindowTime(max time.Duration) *windowedLimitBuilder {
+	w.maxWindowTime = max
+	return w
+}
+
+// MinRttThreshold ignores samples faster than threshold, they are usually not representative(eg. cache hit)
+func (w *windowedLimitBuilder) MinRttThreshold(threshold time.Duration) *windowedLimitBuilder {
+	w.minRttThreshold = threshold
+	return w
+}
+
+// WindowSize is the minimum number of samples a window needs before the delegate limit is updated
+func (w *windowedLimitBuilder) WindowSize(size int) *windowedLimitBuilder {
+	w.windowSize = size
+	return w
+}
+
+// SampleWindow replaces the strategy used to aggregate the samples of a window
+func (w *windowedLimitBuilder) SampleWindow(factory func() window.SampleWindow) *windowedLimitBuilder {
+	w.sampleWindowFactory = factory
+	return w
+}
+
+// Average feeds the delegate limit with the average rtt of a window, which is the default
+func (w *windowedLimitBuilder) Average() *windowedLimitBuilder {
+	w.sampleWindowFactory = window.NewAverageSampleWindow
+	return w
+}
+
+// Percentile feeds the delegate limit with the given percentile(0, 1] of the rtts in a window
+// instead of the average, at most capacity rtts are retained per window
+func (w *windowedLimitBuilder) Percentile(percentile float64, capacity int) *windowedLimitBuilder {
+	w.sampleWindowFactory = func() window.SampleWindow {
+		return window.NewPercentileSampleWindow(percentile, capacity)
+	}
+
+	return w
+}
+
+func (w *windowedLimitBuilder) validate() error {
+	switch {
+	case w.minWindowTime <= 0:
+		return fmt.Errorf("windowed: min window time %v must be positive", w.minWindowTime)
+	case w.minWindowTime > w.maxWindowTime:
+		return fmt.Errorf("windowed: min window time %v must not exceed max window time %v", w.minWindowTime, w.maxWindowTime)
+	case w.minRttThreshold < 0:
+		return fmt.Errorf("windowed: min rtt threshold %v must not be negative", w.minRttThreshold)
+	case w.windowSize <= 0:
+		return fmt.Errorf("windowed: window size %v must be positive", w.windowSize)
+	case w.sampleWindowFactory == nil:
+		return fmt.Errorf("windowed: sample window factory must not be nil")
+	}
+
+	return nil
+}
+
 func (w *windowedLimitBuilder) Build(delegate limits.Limit) limits.Limit {
-	return &WindowedLimit{
+	if err := w.validate(); err != nil {
+		panic(err)
+	}
+
+	wl := &WindowedLimit{
 		Limit:           delegate,
 		minWindowTime:   w.minWindowTime,
 		maxWindowTime:   w.maxWindowTime,
@@ -37,6 +103,9 @@ func (w *windowedLimitBuilder) Build(delegate limits.Limit) limits.Limit {
 		windowSize:      w.windowSize,
 		sample:          window.NewBufferedSampleWindow(w.sampleWindowFactory()),
 	}
+	wl.nextUpdateTime.Store(time.Time{})
+
+	return wl
 }
 
 type WindowedLimit struct {
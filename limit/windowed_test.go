@@ -0,0 +1,70 @@
+package limit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type sample struct {
+	rtt      time.Duration
+	inflight int
+	dropped  bool
+}
+
+type recordingLimit struct {
+	FixedLimit
+	samples []sample
+}
+
+func (r *recordingLimit) OnSample(_ context.Context, _ time.Time, rtt time.Duration, inflight int, dropped bool) {
+	r.samples = append(r.samples, sample{rtt, inflight, dropped})
+}
+
+func TestWindowedLimit(t *testing.T) {
+	delegate := &recordingLimit{FixedLimit: 10}
+	wl := NewWindowedLimitBuilder().
+		MinWindowTime(100 * time.Millisecond).
+		MaxWindowTime(100 * time.Millisecond).
+		WindowSize(5).
+		Build(delegate)
+
+	ctx := context.Background()
+	start := time.Now()
+	// the first sample opens the window, the delegate is updated once the window is both full and elapsed
+	for i := 0; i < 10; i++ {
+		wl.OnSample(ctx, start, 10*time.Millisecond, i, false)
+	}
+
+	if len(delegate.samples) != 0 {
+		t.Fatalf("expected no update before window elapsed, got %v", delegate.samples)
+	}
+
+	wl.OnSample(ctx, start.Add(time.Second), 120*time.Millisecond, 3, false)
+	if len(delegate.samples) != 1 {
+		t.Fatalf("expected exactly one update, got %v", delegate.samples)
+	}
+
+	if s := delegate.samples[0]; s.rtt != 20*time.Millisecond || s.inflight != 9 || s.dropped {
+		t.Fatalf("unexpected aggregated sample %+v", s)
+	}
+}
+
+func TestWindowedLimitBuilderValidate(t *testing.T) {
+	cases := map[string]*windowedLimitBuilder{
+		"min > max":       NewWindowedLimitBuilder().MinWindowTime(2 * time.Second).MaxWindowTime(time.Second),
+		"zero window":     NewWindowedLimitBuilder().WindowSize(0),
+		"zero window min": NewWindowedLimitBuilder().MinWindowTime(0),
+		"nil factory":     NewWindowedLimitBuilder().SampleWindow(nil),
+	}
+
+	for name, builder := range cases {
+		if builder.validate() == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+
+	if err := NewWindowedLimitBuilder().Percentile(0.99, 100).validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -1,57 +1,135 @@
 package limiter
 
 import (
+	"container/list"
 	"context"
-	"errors"
+	"sync"
 	"time"
 
 	"github.com/xtracker/limits"
 )
 
+var _ limits.Limiter = (*BlockingLimiter)(nil)
+
+type BlockingOption func(*BlockingLimiter)
+
+// BlockingMaxWait bounds how long Acquire waits for a permit, a shorter context deadline takes precedence
+func BlockingMaxWait(maxWait time.Duration) BlockingOption {
+	return func(b *BlockingLimiter) {
+		b.maxWait = maxWait
+	}
+}
+
+// NewBlockingLimiter waits for a permit of delegate instead of failing immediately,
+// waiters are served in arrival order. If delegate reports the changes of its limit,
+// waiters are also served when the limit grows.
+func NewBlockingLimiter(delegate limits.Limiter, opts ...BlockingOption) *BlockingLimiter {
+	b := &BlockingLimiter{
+		Limiter: delegate,
+		maxWait: time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	drainOnGrowth(delegate, b.drain)
+	return b
+}
+
+// BlockingLimiter should be created by NewBlockingLimiter. A literal with only the
+// delegate set is usable, but it does not wait and does not follow limit changes.
 type BlockingLimiter struct {
 	limits.Limiter
-	timeout time.Duration
-	ch      chan struct{}
+	mu      sync.Mutex
+	maxWait time.Duration
+	waiters list.List // of *event, oldest at front
 }
 
-func (b *BlockingLimiter) Acquire(ctx context.Context) (limits.Listener, error) {
-	listener, err := b.tryAcquire(ctx)
+func (b *BlockingLimiter) NotifyChange(fn func(int)) {
+	notifyChange(b.Limiter, fn)
+}
 
-	if err == nil {
-		return listener, nil
+func (b *BlockingLimiter) Acquire(ctx context.Context) (limits.Listener, error) {
+	if bypassFromContext(ctx) {
+		return admitBypassed(), nil
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	ctx, cancel := context.WithTimeout(ctx, b.maxWait)
 	defer cancel()
 
-	for {
-		select {
-		case <-b.ch:
-
-		case <-ctx.Done():
-			return nil, errors.New("timeout")
-		}
+	ev := &event{
+		ctx: ctx,
+		c:   make(chan eventData),
+	}
 
-		listener, err := b.tryAcquire(ctx)
+	defer ev.cancel()
 
-		if err == nil {
+	// try and enqueue under the same lock as signal, a release can't slip in between.
+	// a newcomer only bypasses the queue when nobody is waiting
+	b.mu.Lock()
+	b.purge()
+	if b.waiters.Len() == 0 {
+		if listener, err := b.tryAcquire(ctx); err == nil {
+			b.mu.Unlock()
 			return listener, nil
 		}
 	}
 
+	b.waiters.PushBack(ev)
+	b.mu.Unlock()
+
+	select {
+	case data := <-ev.c:
+		return data.listener, data.err
+	case <-ctx.Done():
+		return nil, errTimeout
+	}
+}
+
+// purge drops the waiters at the front that already gave up
+func (b *BlockingLimiter) purge() {
+	for e := b.waiters.Front(); e != nil && e.Value.(*event).Done(); e = b.waiters.Front() {
+		b.waiters.Remove(e)
+	}
 }
 
 func (b *BlockingLimiter) tryAcquire(ctx context.Context) (limits.Listener, error) {
 	listener, err := b.Limiter.Acquire(ctx)
-	if err == nil {
-		return func(ctx context.Context, result limits.Result) {
-			listener(ctx, result)
-			select {
-			case b.ch <- struct{}{}:
-			default:
+	if err != nil {
+		return nil, err
+	}
+
+	return guardListener(func(ctx context.Context, result limits.Result) {
+		listener(ctx, result)
+		b.signal()
+	}), nil
+}
+
+// signal hands a permit to the oldest waiter, the permit is handed over directly
+// so it can't be taken by a newcomer or lost when nobody is selecting.
+// it returns false if there was no waiter or no permit
+func (b *BlockingLimiter) signal() bool {
+	b.mu.Lock()
+	b.purge()
+	if e := b.waiters.Front(); e != nil {
+		candidate := e.Value.(*event)
+		if listener, err := b.tryAcquire(candidate.ctx); err == nil {
+			b.waiters.Remove(e)
+			b.mu.Unlock()
+			if !candidate.signal(listener, nil) {
+				// the waiter already timed out, release the permit to the next one
+				listener(candidate.ctx, limits.IGNORED)
 			}
-		}, nil
+			return true
+		}
 	}
+	b.mu.Unlock()
+	return false
+}
 
-	return nil, err
+// drain serves as many waiters as the delegate admits
+func (b *BlockingLimiter) drain() {
+	for b.signal() {
+	}
 }
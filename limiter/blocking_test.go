@@ -0,0 +1,128 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+func TestBlockingLimiterFifo(t *testing.T) {
+	l := NewBlockingLimiter(&semaphoreLimiter{max: 1})
+
+	holder, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grants := make(chan grant, 3)
+	hold := make(chan struct{})
+	for id := 1; id <= 3; id++ {
+		enqueue(l, context.Background(), id, grants, hold)
+	}
+
+	holder(context.Background(), limits.SUCCESS)
+	for _, expected := range []int{1, 2, 3} {
+		g := <-grants
+		if g.id != expected || g.err != nil {
+			t.Fatalf("expected waiter %d to be granted, got %+v", expected, g)
+		}
+		hold <- struct{}{}
+	}
+}
+
+func TestBlockingLimiterTimeout(t *testing.T) {
+	l := NewBlockingLimiter(&semaphoreLimiter{max: 1}, BlockingMaxWait(20*time.Millisecond))
+
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := l.Acquire(context.Background()); err != errTimeout {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected max wait to be honoured, waited %v", elapsed)
+	}
+
+	// the context deadline is honoured when shorter than the max wait
+	l = NewBlockingLimiter(&semaphoreLimiter{max: 1}, BlockingMaxWait(time.Hour))
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); err != errTimeout {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
+
+func TestBlockingLimiterNoLostWakeup(t *testing.T) {
+	const permits, callers, rounds = 4, 64, 50
+
+	sem := &semaphoreLimiter{max: permits}
+	l := NewBlockingLimiter(sem, BlockingMaxWait(time.Minute))
+
+	var failed int32
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				listener, err := l.Acquire(context.Background())
+				if err != nil {
+					atomic.AddInt32(&failed, 1)
+					continue
+				}
+				listener(context.Background(), limits.SUCCESS)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// a lost wakeup leaves a caller waiting for the full minute
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("callers are stuck, a released permit did not reach a waiter")
+	}
+
+	if failed != 0 {
+		t.Fatalf("%d acquires failed", failed)
+	}
+
+	if sem.inFlight != 0 {
+		t.Fatalf("%d permits leaked", sem.inFlight)
+	}
+}
+
+func TestBlockingLimiterLiteral(t *testing.T) {
+	l := &BlockingLimiter{Limiter: &semaphoreLimiter{max: 1}}
+
+	listener, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a literal does not wait
+	if _, err := l.Acquire(context.Background()); err != errTimeout {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+
+	listener(context.Background(), limits.SUCCESS)
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
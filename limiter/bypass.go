@@ -0,0 +1,87 @@
+package limiter
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/xtracker/limits"
+)
+
+var _ limits.Limiter = (*BypassLimiter)(nil)
+
+type bypassCtxKey struct{}
+
+// WithBypass marks the request to skip limiting, eg. health checks and admin calls.
+// Every limiter of this package admits a marked request without a permit or a sample.
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCtxKey{}, true)
+}
+
+func bypassFromContext(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassCtxKey{}).(bool)
+	return bypass
+}
+
+// bypassListener holds no permit and feeds no sample
+func bypassListener(context.Context, limits.Result) {}
+
+var bypassedTotal int64
+
+// admitBypassed counts a request admitted without limiting and returns its listener
+func admitBypassed() limits.Listener {
+	atomic.AddInt64(&bypassedTotal, 1)
+	return bypassListener
+}
+
+// BypassedTotal returns the number of requests the limiters of this package admitted without limiting,
+// a request passing through several of them is counted once
+func BypassedTotal() int64 {
+	return atomic.LoadInt64(&bypassedTotal)
+}
+
+type BypassOption func(*BypassLimiter)
+
+// BypassIf bypasses the requests matching predicate, in addition to those marked by WithBypass
+func BypassIf(predicate func(context.Context) bool) BypassOption {
+	return func(b *BypassLimiter) {
+		b.predicate = predicate
+	}
+}
+
+// NewBypassLimiter admits the requests matching its predicates without asking delegate,
+// and counts the bypassed requests. Use it for limiters outside this package.
+func NewBypassLimiter(delegate limits.Limiter, opts ...BypassOption) *BypassLimiter {
+	b := &BypassLimiter{
+		Limiter: delegate,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+type BypassLimiter struct {
+	limits.Limiter
+	predicate func(context.Context) bool
+	bypassed  int64
+}
+
+func (b *BypassLimiter) Acquire(ctx context.Context) (limits.Listener, error) {
+	if bypassFromContext(ctx) || (b.predicate != nil && b.predicate(ctx)) {
+		atomic.AddInt64(&b.bypassed, 1)
+		return admitBypassed(), nil
+	}
+
+	return b.Limiter.Acquire(ctx)
+}
+
+func (b *BypassLimiter) NotifyChange(fn func(int)) {
+	notifyChange(b.Limiter, fn)
+}
+
+// Bypassed returns the number of requests admitted without limiting
+func (b *BypassLimiter) Bypassed() int64 {
+	return atomic.LoadInt64(&b.bypassed)
+}
@@ -0,0 +1,87 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+	"github.com/xtracker/limits/limit"
+)
+
+type adminKey struct{}
+
+func TestBypassLimiter(t *testing.T) {
+	sink := limit.NewRingSink(16)
+	l := NewBypassLimiter(
+		NewSimpleLimiter("", limit.NewTracingLimit(limit.FixedLimit(1), sink)),
+		BypassIf(func(ctx context.Context) bool { return ctx.Value(adminKey{}) != nil }),
+	)
+
+	ctx := context.Background()
+	total := BypassedTotal()
+	held := acquireN(t, l, ctx, 1)
+	if _, err := l.Acquire(ctx); err == nil {
+		t.Fatal("expected the limit to be reached")
+	}
+
+	for _, bctx := range []context.Context{WithBypass(ctx), context.WithValue(ctx, adminKey{}, true)} {
+		listener, err := l.Acquire(bctx)
+		if err != nil {
+			t.Fatalf("bypassed request rejected: %v", err)
+		}
+		listener(bctx, limits.DROPPED)
+	}
+
+	if n := l.Bypassed(); n != 2 || BypassedTotal()-total != 2 {
+		t.Fatalf("expected 2 bypassed requests, got %d and %d in total", n, BypassedTotal()-total)
+	}
+
+	if traces := sink.Traces(); len(traces) != 0 {
+		t.Fatalf("bypassed requests must not feed samples, got %v", traces)
+	}
+
+	held[0](ctx, limits.SUCCESS)
+	if traces := sink.Traces(); len(traces) != 1 {
+		t.Fatalf("expected 1 sample, got %d", len(traces))
+	}
+}
+
+func TestWithBypassLimiters(t *testing.T) {
+	newSimple := func() limits.Limiter { return NewSimpleLimiter("", limit.FixedLimit(1)) }
+	limiters := map[string]limits.Limiter{
+		"simple":      newSimple(),
+		"priority":    NewPriorityLimiterBuilder(newSimple()).Timeout(time.Millisecond).Build(),
+		"blocking":    NewBlockingLimiter(newSimple(), BlockingMaxWait(time.Millisecond)),
+		"lifo":        NewLifoLimiterBuilder(newSimple()).Timeout(time.Millisecond).Build(),
+		"deadline":    NewDeadlineLimiterBuilder(newSimple()).Build(),
+		"partitioned": NewPartitionedLimiterBuilder("", limit.FixedLimit(1)).Build(),
+	}
+
+	for name, l := range limiters {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			held := acquireN(t, l, ctx, 1)
+
+			total := BypassedTotal()
+			bctx := WithBypass(ctx)
+			listener, err := l.Acquire(bctx)
+			if err != nil {
+				t.Fatalf("bypassed request rejected: %v", err)
+			}
+			listener(bctx, limits.SUCCESS)
+
+			if n := BypassedTotal() - total; n != 1 {
+				t.Fatalf("expected the bypassed request to be counted once, got %d", n)
+			}
+
+			// the bypassed request neither took nor released a permit
+			if _, err := l.Acquire(ctx); err == nil {
+				t.Fatal("expected the limit to be reached")
+			}
+
+			held[0](ctx, limits.SUCCESS)
+			acquireN(t, l, ctx, 1)
+		})
+	}
+}
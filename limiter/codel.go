@@ -0,0 +1,31 @@
+package limiter
+
+import "time"
+
+// codel detects a standing backlog, as in Controlled Delay: the backlog stands when the
+// sojourn of the waiters stayed above target for a whole interval. While it stands, the
+// waiters that already waited longer than target are shed, until one is served within target again.
+type codel struct {
+	target         time.Duration
+	interval       time.Duration
+	firstAboveTime time.Time // when the backlog stands if no sojourn drops below target, zero if below
+	overloaded     bool
+}
+
+// observe records the sojourn of a waiter leaving the backlog, 0 when the backlog drained
+func (c *codel) observe(now time.Time, sojourn time.Duration) {
+	switch {
+	case sojourn < c.target:
+		c.firstAboveTime = time.Time{}
+		c.overloaded = false
+	case c.firstAboveTime.IsZero():
+		// the first sojourn above target, wait an interval in case it's a transient burst
+		c.firstAboveTime = now.Add(c.interval)
+	case !now.Before(c.firstAboveTime):
+		c.overloaded = true
+	}
+}
+
+func (c *codel) shed(now time.Time, ev *event) bool {
+	return c.overloaded && now.Sub(ev.arrival) > c.target
+}
@@ -0,0 +1,115 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+func TestCoDel(t *testing.T) {
+	c := &codel{target: 5 * time.Millisecond, interval: 100 * time.Millisecond}
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	// a waiter served within target during the interval, the backlog does not stand
+	c.observe(at(0), 20*time.Millisecond)
+	c.observe(at(50), 2*time.Millisecond)
+	c.observe(at(90), 20*time.Millisecond)
+	c.observe(at(110), 20*time.Millisecond)
+	if c.overloaded {
+		t.Fatal("expected no standing backlog")
+	}
+
+	c.observe(at(150), 30*time.Millisecond)
+	c.observe(at(220), 10*time.Millisecond)
+	if !c.overloaded {
+		t.Fatal("expected a standing backlog")
+	}
+
+	old := &event{arrival: at(200)}
+	young := &event{arrival: at(218)}
+	if !c.shed(at(220), old) || c.shed(at(220), young) {
+		t.Fatal("expected only the waiters older than target to be shed")
+	}
+
+	// a waiter served within target ends the shedding
+	c.observe(at(230), time.Millisecond)
+	if c.overloaded {
+		t.Fatal("expected the standing backlog to be drained")
+	}
+
+	// a drained backlog restarts the interval
+	c.observe(at(240), 30*time.Millisecond)
+	c.observe(at(300), 0)
+	c.observe(at(360), 30*time.Millisecond)
+	if c.overloaded {
+		t.Fatal("expected no standing backlog after the backlog drained")
+	}
+}
+
+func TestCoDelSparseReleases(t *testing.T) {
+	c := &codel{target: 5 * time.Millisecond, interval: 100 * time.Millisecond}
+	start := time.Now()
+
+	// releases sparser than interval, every sojourn above target
+	for i := 0; i < 3; i++ {
+		c.observe(start.Add(time.Duration(i)*300*time.Millisecond), time.Duration(i+1)*300*time.Millisecond)
+	}
+
+	if !c.overloaded {
+		t.Fatal("expected a standing backlog")
+	}
+}
+
+func TestPriorityLimiterCoDel(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		b := NewPriorityLimiterBuilder(&semaphoreLimiter{max: 1}).Timeout(time.Minute)
+		if enabled {
+			b.CoDel(5*time.Millisecond, 30*time.Millisecond)
+		}
+		l := b.Build()
+
+		holder, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a standing backlog of waiters served every 10ms
+		const waiters = 20
+		errs := make(chan error, waiters)
+		for i := 0; i < waiters; i++ {
+			go func() {
+				listener, err := l.Acquire(context.Background())
+				if err == nil {
+					time.Sleep(10 * time.Millisecond)
+					listener(context.Background(), limits.SUCCESS)
+				}
+				errs <- err
+			}()
+		}
+		time.Sleep(10 * time.Millisecond)
+		holder(context.Background(), limits.SUCCESS)
+
+		start := time.Now()
+		shed := 0
+		for i := 0; i < waiters; i++ {
+			if err := <-errs; errors.Is(err, ErrShed) {
+				shed++
+			} else if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+		}
+
+		switch {
+		case !enabled && shed != 0:
+			t.Fatalf("expected no waiter to be shed, got %d", shed)
+		case enabled && shed == 0:
+			t.Fatal("expected the standing backlog to be shed")
+		case enabled && time.Since(start) > 150*time.Millisecond:
+			t.Fatalf("expected the backlog to drain early, took %v", time.Since(start))
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/xtracker/limits"
+	"github.com/xtracker/limits/limit/measurement"
+)
+
+var _ limits.Limiter = (*deadlineLimiter)(nil)
+
+// DeadlineError is returned when the context deadline leaves less time than the estimated service time
+type DeadlineError struct {
+	Remaining time.Duration
+	Estimated time.Duration
+}
+
+func (e *DeadlineError) Error() string {
+	return fmt.Sprintf("limits error: %v left before deadline, estimated service time is %v", e.Remaining, e.Estimated)
+}
+
+type deadlineLimiterBuilder struct {
+	delegate     limits.Limiter
+	window       int
+	warmupWindow int
+}
+
+func NewDeadlineLimiterBuilder(delegate limits.Limiter) *deadlineLimiterBuilder {
+	return &deadlineLimiterBuilder{
+		delegate:     delegate,
+		window:       100,
+		warmupWindow: 10,
+	}
+}
+
+// Window is the number of successful requests the service time is averaged over,
+// no request is rejected until warmup requests completed
+func (db *deadlineLimiterBuilder) Window(window, warmup int) *deadlineLimiterBuilder {
+	db.window, db.warmupWindow = window, warmup
+	return db
+}
+
+func (db *deadlineLimiterBuilder) Build() limits.Limiter {
+	if db.window <= 0 || db.warmupWindow <= 0 {
+		panic("deadline: window and warmup must be positive")
+	}
+
+	return &deadlineLimiter{
+		Limiter:      db.delegate,
+		serviceTime:  measurement.NewAverageMeasurement(db.window, db.warmupWindow),
+		warmupWindow: db.warmupWindow,
+	}
+}
+
+// deadlineLimiter rejects requests whose callers will give up before they could be served,
+// and stops a blocking delegate from waiting past the point where that would be the case
+type deadlineLimiter struct {
+	limits.Limiter
+	serviceTime  measurement.Measurement
+	warmupWindow int
+	completed    int64
+}
+
+func (d *deadlineLimiter) estimate() time.Duration {
+	if atomic.LoadInt64(&d.completed) < int64(d.warmupWindow) {
+		return 0
+	}
+
+	return time.Duration(d.serviceTime.Get().Int64())
+}
+
+func (d *deadlineLimiter) NotifyChange(fn func(int)) {
+	notifyChange(d.Limiter, fn)
+}
+
+func (d *deadlineLimiter) Acquire(ctx context.Context) (limits.Listener, error) {
+	if bypassFromContext(ctx) {
+		return admitBypassed(), nil
+	}
+
+	estimated := d.estimate()
+	deadline, ok := ctx.Deadline()
+	if !ok || estimated == 0 {
+		return d.acquire(ctx)
+	}
+
+	if remaining := time.Until(deadline); remaining < estimated {
+		return nil, &DeadlineError{Remaining: remaining, Estimated: estimated}
+	}
+
+	// shorten the wait budget of the delegate, a permit acquired later would be wasted
+	waitCtx, cancel := context.WithDeadline(ctx, deadline.Add(-estimated))
+	defer cancel()
+
+	listener, err := d.acquire(waitCtx)
+	if err != nil && waitCtx.Err() != nil && ctx.Err() == nil {
+		return nil, &DeadlineError{Remaining: time.Until(deadline), Estimated: estimated}
+	}
+
+	return listener, err
+}
+
+func (d *deadlineLimiter) acquire(ctx context.Context) (limits.Listener, error) {
+	listener, err := d.Limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	return guardListener(func(ctx context.Context, result limits.Result) {
+		if result == limits.SUCCESS {
+			d.serviceTime.Add(measurement.Int64Number(time.Since(startTime)))
+			atomic.AddInt64(&d.completed, 1)
+		}
+
+		listener(ctx, result)
+	}), nil
+}
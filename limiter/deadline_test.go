@@ -0,0 +1,73 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+	"github.com/xtracker/limits/limit/measurement"
+)
+
+func warmup(l limits.Limiter, serviceTime time.Duration) {
+	d := l.(*deadlineLimiter)
+	for i := 0; i < d.warmupWindow; i++ {
+		d.serviceTime.Add(measurement.Int64Number(serviceTime))
+		d.completed++
+	}
+}
+
+func TestDeadlineLimiterRejects(t *testing.T) {
+	l := NewDeadlineLimiterBuilder(&semaphoreLimiter{max: 10}).Build()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// no estimate before warmup
+	if _, err := l.Acquire(ctx); err != nil {
+		t.Fatalf("unexpected error before warmup %v", err)
+	}
+
+	warmup(l, 50*time.Millisecond)
+
+	_, err := l.Acquire(ctx)
+	var deadlineErr *DeadlineError
+	if !errors.As(err, &deadlineErr) || deadlineErr.Estimated != 50*time.Millisecond {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("expected requests without deadline to be admitted, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := l.Acquire(ctx); err != nil {
+		t.Fatalf("expected request with enough time to be admitted, got %v", err)
+	}
+}
+
+func TestDeadlineLimiterShortensWait(t *testing.T) {
+	blocking := NewBlockingLimiter(&semaphoreLimiter{max: 1}, BlockingMaxWait(time.Minute))
+	l := NewDeadlineLimiterBuilder(blocking).Build()
+	warmup(l, 100*time.Millisecond)
+
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := l.Acquire(ctx)
+	var deadlineErr *DeadlineError
+	if !errors.As(err, &deadlineErr) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 120*time.Millisecond {
+		t.Fatalf("expected the wait to stop 100ms before the deadline, waited %v", elapsed)
+	}
+}
@@ -0,0 +1,337 @@
+package limiter
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/xtracker/limits/util"
+)
+
+type tenantCtxKey struct{}
+
+// WithTenant marks the request as belonging to tenant, used by fair queuing
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set by WithTenant
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantCtxKey{}).(string)
+	return tenant, ok
+}
+
+// backlog holds the waiters of a priority limiter, PeekFirst is the next waiter to serve
+// and the one polled by PollFirst
+type backlog interface {
+	Offer(*event) (*event, bool)
+	PeekFirst() (*event, bool)
+	PollFirst() (*event, bool)
+}
+
+type tenantQueue struct {
+	name     string
+	weight   float64
+	deficit  float64
+	credited bool // the deficit was credited for the current visit
+	waiters  util.Deque[*event]
+	elem     *list.Element
+}
+
+type fairClass struct {
+	priority int
+	tenants  map[string]*tenantQueue
+	active   *list.List // of *tenantQueue, round robin order
+}
+
+// fairBacklog serves priority classes by level, and shares each class between tenants
+// with deficit round robin, every tenant is served weight waiters per round on average.
+// The level of a class is its priority, raised by aging the longer its oldest waiter waits.
+type fairBacklog struct {
+	capacity      int
+	len           int
+	discipline    Discipline
+	fair          bool // without fair queuing every waiter belongs to the same tenant
+	weights       map[string]float64
+	defaultWeight float64
+	aging         map[int]time.Duration // priority -> wait to gain one level
+	classes       []*fairClass          // by descending priority
+	peeked        *fairPick             // polled next, levels change over time
+}
+
+type fairPick struct {
+	class    *fairClass
+	tenant   *tenantQueue
+	fromBack bool
+}
+
+func newFairBacklog(capacity int, discipline Discipline, weights map[string]float64, defaultWeight float64) *fairBacklog {
+	return &fairBacklog{
+		capacity:      capacity,
+		discipline:    discipline,
+		fair:          true,
+		weights:       weights,
+		defaultWeight: defaultWeight,
+	}
+}
+
+func newAgingBacklog(capacity int, discipline Discipline, aging map[int]time.Duration) *fairBacklog {
+	return &fairBacklog{
+		capacity:      capacity,
+		discipline:    discipline,
+		defaultWeight: 1,
+		aging:         aging,
+	}
+}
+
+func (b *fairBacklog) classOf(ev *event) int {
+	// the other disciplines ignore priorities
+	if b.discipline == PriorityLifo || b.discipline == PriorityFifo {
+		return ev.priority
+	}
+
+	return 0
+}
+
+func (b *fairBacklog) class(priority int, create bool) *fairClass {
+	i := sort.Search(len(b.classes), func(i int) bool { return b.classes[i].priority <= priority })
+	if i < len(b.classes) && b.classes[i].priority == priority {
+		return b.classes[i]
+	}
+
+	if !create {
+		return nil
+	}
+
+	c := &fairClass{priority: priority, tenants: make(map[string]*tenantQueue), active: list.New()}
+	b.classes = append(b.classes, nil)
+	copy(b.classes[i+1:], b.classes[i:])
+	b.classes[i] = c
+	return c
+}
+
+func (b *fairBacklog) tenant(c *fairClass, name string, create bool) *tenantQueue {
+	if t, ok := c.tenants[name]; ok || !create {
+		return t
+	}
+
+	weight, ok := b.weights[name]
+	if !ok {
+		weight = b.defaultWeight
+	}
+
+	t := &tenantQueue{name: name, weight: weight, waiters: util.NewPriorityDeque[*event](b.capacity)}
+	t.elem = c.active.PushBack(t)
+	c.tenants[name] = t
+	return t
+}
+
+// remove drops the bookkeeping of an empty tenant, and of its class if it became empty too.
+// an idle tenant loses its deficit like in deficit round robin
+func (b *fairBacklog) remove(c *fairClass, t *tenantQueue) {
+	if t.waiters.Len() > 0 {
+		return
+	}
+
+	c.active.Remove(t.elem)
+	delete(c.tenants, t.name)
+	if c.active.Len() > 0 {
+		return
+	}
+
+	for i := range b.classes {
+		if b.classes[i] == c {
+			b.classes = append(b.classes[:i], b.classes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (b *fairBacklog) tenantOf(ev *event) string {
+	if !b.fair {
+		return ""
+	}
+
+	tenant, _ := TenantFromContext(ev.ctx)
+	return tenant
+}
+
+func (b *fairBacklog) Offer(ev *event) (*event, bool) {
+	b.peeked = nil
+	tenantName := b.tenantOf(ev)
+	var evicted *event
+	if b.len >= b.capacity {
+		var ok bool
+		if evicted, ok = b.evict(ev, tenantName); !ok {
+			return nil, false
+		}
+	}
+
+	t := b.tenant(b.class(b.classOf(ev), true), tenantName, true)
+	t.waiters.Offer(ev)
+	b.len++
+	return evicted, true
+}
+
+// evict makes room for ev in a full backlog. The victim is the last waiter of the tenant
+// with the most waiters in the lowest priority class, ev itself may be rejected.
+func (b *fairBacklog) evict(ev *event, tenantName string) (*event, bool) {
+	if len(b.classes) == 0 {
+		return nil, false
+	}
+
+	lowest := b.classes[len(b.classes)-1]
+	priority := b.classOf(ev)
+	if priority < lowest.priority {
+		return nil, false
+	}
+
+	var victim *tenantQueue
+	for e := lowest.active.Front(); e != nil; e = e.Next() {
+		if t := e.Value.(*tenantQueue); victim == nil || t.waiters.Len() > victim.waiters.Len() {
+			victim = t
+		}
+	}
+
+	if priority == lowest.priority {
+		if own := lowest.tenants[tenantName]; own != nil && own.waiters.Len() >= victim.waiters.Len() {
+			// the newcomer's tenant is the greediest, it competes with its own waiters only
+			if last, _ := own.waiters.PeekLast(); last.Less(ev) {
+				return nil, false
+			}
+			victim = own
+		}
+	}
+
+	evicted, _ := victim.waiters.PollLast()
+	b.len--
+	b.remove(lowest, victim)
+	return evicted, true
+}
+
+// oldest returns the waiter of t that waits the longest
+func (b *fairBacklog) oldest(t *tenantQueue) (*event, bool) {
+	if b.discipline == PriorityLifo || b.discipline == Lifo {
+		return t.waiters.PeekLast()
+	}
+
+	return t.waiters.PeekFirst()
+}
+
+func (b *fairBacklog) level(c *fairClass, now time.Time) int {
+	step, ok := b.aging[c.priority]
+	if !ok {
+		return c.priority
+	}
+
+	var arrival time.Time
+	for e := c.active.Front(); e != nil; e = e.Next() {
+		if ev, ok := b.oldest(e.Value.(*tenantQueue)); ok && (arrival.IsZero() || ev.arrival.Before(arrival)) {
+			arrival = ev.arrival
+		}
+	}
+
+	return c.priority + int(now.Sub(arrival)/step)
+}
+
+// nextClass returns the class with the highest level, a class raised by aging serves
+// its oldest waiters first. On a tie the class of the higher priority wins.
+func (b *fairBacklog) nextClass(now time.Time) (*fairClass, bool) {
+	next, nextLevel := b.classes[0], b.classes[0].priority
+	for _, c := range b.classes {
+		if level := b.level(c, now); level > nextLevel {
+			next, nextLevel = c, level
+		}
+	}
+
+	return next, nextLevel > next.priority
+}
+
+// purge drops the waiters that gave up at the end of t served next, they are not charged
+func (b *fairBacklog) purge(t *tenantQueue, fromBack bool) bool {
+	peek, poll := t.waiters.PeekFirst, t.waiters.PollFirst
+	if fromBack {
+		peek, poll = t.waiters.PeekLast, t.waiters.PollLast
+	}
+
+	purged := false
+	for ev, ok := peek(); ok && ev.Done(); ev, ok = peek() {
+		poll()
+		b.len--
+		purged = true
+	}
+
+	return purged
+}
+
+func (b *fairBacklog) next() *fairPick {
+	now := time.Now()
+	for len(b.classes) > 0 {
+		c, aged := b.nextClass(now)
+		t := c.active.Front().Value.(*tenantQueue)
+		fromBack := aged && b.discipline == PriorityLifo
+
+		if b.purge(t, fromBack) {
+			// the levels may have changed
+			b.remove(c, t)
+			continue
+		}
+
+		if !t.credited {
+			t.deficit += t.weight
+			t.credited = true
+		}
+
+		if t.deficit >= 1 {
+			return &fairPick{class: c, tenant: t, fromBack: fromBack}
+		}
+
+		// the visit is over, the deficit is kept for the next round
+		t.credited = false
+		c.active.MoveToBack(t.elem)
+	}
+
+	return nil
+}
+
+func (b *fairBacklog) PeekFirst() (*event, bool) {
+	b.peeked = b.next()
+	if b.peeked == nil {
+		return nil, false
+	}
+
+	if b.peeked.fromBack {
+		return b.peeked.tenant.waiters.PeekLast()
+	}
+
+	return b.peeked.tenant.waiters.PeekFirst()
+}
+
+// PollFirst removes the waiter returned by the last PeekFirst, if no waiter was offered since
+func (b *fairBacklog) PollFirst() (*event, bool) {
+	pick := b.peeked
+	if b.peeked = nil; pick == nil {
+		pick = b.next()
+	}
+
+	if pick == nil {
+		return nil, false
+	}
+
+	t := pick.tenant
+	poll := t.waiters.PollFirst
+	if pick.fromBack {
+		poll = t.waiters.PollLast
+	}
+
+	ev, _ := poll()
+	b.len--
+	t.deficit--
+	if t.waiters.Len() == 0 {
+		t.deficit, t.credited = 0, false
+		b.remove(pick.class, t)
+	}
+
+	return ev, true
+}
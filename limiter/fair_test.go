@@ -0,0 +1,160 @@
+package limiter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+var arrival time.Time
+
+// waiter returns a waiter of tenant, ordered like the waiters of b.
+// arrivals are strictly increasing, even on a coarse clock
+func waiter(b *fairBacklog, tenant string, priority int) *event {
+	if now := time.Now(); now.After(arrival) {
+		arrival = now
+	} else {
+		arrival = arrival.Add(time.Nanosecond)
+	}
+
+	return &event{
+		ctx:        WithTenant(context.Background(), tenant),
+		priority:   priority,
+		arrival:    arrival,
+		discipline: b.discipline,
+	}
+}
+
+func pollIds(b backlog, n int) string {
+	ids := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		ev, ok := b.PollFirst()
+		if !ok {
+			break
+		}
+		tenant, _ := TenantFromContext(ev.ctx)
+		ids = append(ids, tenant)
+	}
+
+	return strings.Join(ids, "")
+}
+
+func TestFairBacklogWeights(t *testing.T) {
+	b := newFairBacklog(64, PriorityFifo, map[string]float64{"a": 3, "b": 1}, 1)
+	for i := 0; i < 8; i++ {
+		b.Offer(waiter(b, "a", 0))
+	}
+	for i := 0; i < 8; i++ {
+		b.Offer(waiter(b, "b", 0))
+	}
+
+	if order := pollIds(b, 8); order != "aaabaaab" {
+		t.Fatalf("expected a to get 3 waiters per round, got %s", order)
+	}
+
+	// an idle tenant loses its deficit, b is served alone
+	if order := pollIds(b, 8); order != "aabbbbbb" {
+		t.Fatalf("unexpected order %s", order)
+	}
+}
+
+func TestFairBacklogFractionalWeight(t *testing.T) {
+	b := newFairBacklog(64, PriorityFifo, map[string]float64{"b": 0.5}, 1)
+	for i := 0; i < 4; i++ {
+		b.Offer(waiter(b, "a", 0))
+		b.Offer(waiter(b, "b", 0))
+	}
+
+	if order := pollIds(b, 6); order != "aabaab" {
+		t.Fatalf("expected b to be served every other round, got %s", order)
+	}
+}
+
+func TestFairBacklogPriority(t *testing.T) {
+	b := newFairBacklog(64, PriorityLifo, nil, 1)
+	b.Offer(waiter(b, "a", 0))
+	b.Offer(waiter(b, "a", 0))
+	b.Offer(waiter(b, "b", 1))
+	b.Offer(waiter(b, "c", 0))
+
+	if order := pollIds(b, 4); order != "baca" {
+		t.Fatalf("expected the higher priority to be served first, got %s", order)
+	}
+}
+
+func TestFairBacklogEviction(t *testing.T) {
+	b := newFairBacklog(4, PriorityFifo, nil, 1)
+	for i := 0; i < 3; i++ {
+		b.Offer(waiter(b, "a", 0))
+	}
+	b.Offer(waiter(b, "b", 0))
+
+	// the greediest tenant loses its last waiter
+	evicted, ok := b.Offer(waiter(b, "b", 0))
+	if tenant, _ := TenantFromContext(evicted.ctx); !ok || tenant != "a" {
+		t.Fatalf("expected a waiter of a to be evicted, got %v %v", tenant, ok)
+	}
+
+	// a newcomer of the greediest tenant competes with its own waiters only
+	if _, ok := b.Offer(waiter(b, "b", 0)); ok {
+		t.Fatal("expected the newest fifo waiter to be rejected")
+	}
+
+	// a higher priority newcomer always finds room
+	if _, ok := b.Offer(waiter(b, "c", 1)); !ok {
+		t.Fatal("expected the higher priority waiter to be admitted")
+	}
+
+	if order := pollIds(b, 4); order != "cabb" {
+		t.Fatalf("unexpected order %s", order)
+	}
+}
+
+func TestPriorityLimiterFairQueuing(t *testing.T) {
+	l := NewPriorityLimiterBuilder(&semaphoreLimiter{max: 1}).
+		Discipline(PriorityFifo).
+		FairQueuing(1).
+		TenantWeight("b", 2).
+		Build()
+
+	holder, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grants := make(chan grant, 6)
+	hold := make(chan struct{})
+	for id := 1; id <= 6; id++ {
+		tenant := "a"
+		if id > 3 {
+			tenant = "b"
+		}
+		enqueue(l, WithTenant(context.Background(), tenant), id, grants, hold)
+	}
+
+	holder(context.Background(), limits.SUCCESS)
+	for _, expected := range []int{1, 4, 5, 2, 6, 3} {
+		g := <-grants
+		if g.id != expected || g.err != nil {
+			t.Fatalf("expected waiter %d to be granted, got %+v", expected, g)
+		}
+		hold <- struct{}{}
+	}
+}
+
+func TestAgingBacklog(t *testing.T) {
+	b := newAgingBacklog(64, PriorityLifo, map[int]time.Duration{0: 30 * time.Millisecond})
+	old := waiter(b, "a", 0)
+	old.arrival = time.Now().Add(-100 * time.Millisecond)
+	b.Offer(old)
+	b.Offer(waiter(b, "b", 0))
+	b.Offer(waiter(b, "c", 2))
+
+	// a waited for 3 levels, and is served before the newer b despite lifo
+	if order := pollIds(b, 3); order != "acb" {
+		t.Fatalf("expected the aged waiter to be served first, got %s", order)
+	}
+}
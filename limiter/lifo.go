@@ -0,0 +1,11 @@
+package limiter
+
+import "github.com/xtracker/limits"
+
+// NewLifoLimiterBuilder builds a priority limiter serving the most recent waiter first,
+// priorities are ignored. Under sustained overload the newest requests still have a chance
+// to finish before their callers give up. When the backlog is full, the oldest waiter is
+// evicted with ErrEvicted.
+func NewLifoLimiterBuilder(delegate limits.Limiter) *priorityLimiterBuilder {
+	return NewPriorityLimiterBuilder(delegate).Discipline(Lifo)
+}
@@ -0,0 +1,126 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+// semaphoreLimiter admits up to max requests and releases a permit on every listener call
+type semaphoreLimiter struct {
+	max      int32
+	inFlight int32
+}
+
+func (s *semaphoreLimiter) Acquire(context.Context) (limits.Listener, error) {
+	if atomic.AddInt32(&s.inFlight, 1) > atomic.LoadInt32(&s.max) {
+		atomic.AddInt32(&s.inFlight, -1)
+		return nil, errLimitExceeded
+	}
+
+	return func(context.Context, limits.Result) {
+		atomic.AddInt32(&s.inFlight, -1)
+	}, nil
+}
+
+type grant struct {
+	id  int
+	err error
+}
+
+// enqueue starts a waiter and gives it time to reach the backlog, so waiters are queued in call order
+func enqueue(l limits.Limiter, ctx context.Context, id int, grants chan<- grant, hold <-chan struct{}) {
+	go func() {
+		listener, err := l.Acquire(ctx)
+		grants <- grant{id, err}
+		if err == nil {
+			<-hold
+			listener(ctx, limits.SUCCESS)
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestLifoLimiterOrder(t *testing.T) {
+	l := NewLifoLimiterBuilder(&semaphoreLimiter{max: 1}).Build()
+
+	holder, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grants := make(chan grant, 3)
+	hold := make(chan struct{})
+	for id := 1; id <= 3; id++ {
+		enqueue(l, context.Background(), id, grants, hold)
+	}
+
+	holder(context.Background(), limits.SUCCESS)
+	for _, expected := range []int{3, 2, 1} {
+		g := <-grants
+		if g.id != expected || g.err != nil {
+			t.Fatalf("expected waiter %d to be granted, got %+v", expected, g)
+		}
+		hold <- struct{}{}
+	}
+}
+
+func TestLifoLimiterEviction(t *testing.T) {
+	l := NewLifoLimiterBuilder(&semaphoreLimiter{max: 1}).BacklogSize(2).Build()
+
+	holder, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grants := make(chan grant, 3)
+	hold := make(chan struct{})
+	for id := 1; id <= 3; id++ {
+		enqueue(l, context.Background(), id, grants, hold)
+	}
+
+	if g := <-grants; g.id != 1 || !errors.Is(g.err, ErrEvicted) {
+		t.Fatalf("expected the oldest waiter to be evicted, got %+v", g)
+	}
+
+	holder(context.Background(), limits.SUCCESS)
+	if g := <-grants; g.id != 3 || g.err != nil {
+		t.Fatalf("expected the newest waiter to be granted, got %+v", g)
+	}
+	close(hold)
+
+	if g := <-grants; g.id != 2 || g.err != nil {
+		t.Fatalf("expected the remaining waiter to be granted, got %+v", g)
+	}
+}
+
+func TestLifoLimiterDeadline(t *testing.T) {
+	l := NewLifoLimiterBuilder(&semaphoreLimiter{max: 1}).Timeout(time.Second).Build()
+
+	holder, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := l.Acquire(ctx); err != errTimeout {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected the context deadline to be honoured, waited %v", elapsed)
+	}
+
+	// the permit released after the waiter gave up is not lost
+	holder(context.Background(), limits.SUCCESS)
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -15,6 +15,72 @@ var (
 
 var errLimitExceeded = errors.New("limits error: max inflight exceeded")
 
+// changeNotifier is implemented by the limiters reporting the changes of their limit
+type changeNotifier interface {
+	NotifyChange(func(int))
+}
+
+// notifyChange subscribes fn to the limit changes of l, if l reports them
+func notifyChange(l limits.Limiter, fn func(int)) {
+	if n, ok := l.(changeNotifier); ok {
+		n.NotifyChange(fn)
+	}
+}
+
+const (
+	drainIdle    int32 = iota
+	drainRunning       // a drain goroutine is running
+	drainAgain         // the limit grew again while draining, drain once more
+)
+
+// drainer runs drain in the background when the limit grows, the drains requested
+// while one is running are coalesced into a single one after it
+type drainer struct {
+	drain func()
+	last  int64 // last limit seen
+	state int32
+}
+
+// drainOnGrowth subscribes drain to the growths of the limit of l, if l reports its changes
+func drainOnGrowth(l limits.Limiter, drain func()) {
+	d := &drainer{drain: drain}
+	notifyChange(l, d.onChange)
+}
+
+func (d *drainer) onChange(limit int) {
+	// a lower limit admits no waiter
+	if int64(limit) <= atomic.SwapInt64(&d.last, int64(limit)) {
+		return
+	}
+
+	for {
+		switch atomic.LoadInt32(&d.state) {
+		case drainIdle:
+			if atomic.CompareAndSwapInt32(&d.state, drainIdle, drainRunning) {
+				go d.run()
+				return
+			}
+		case drainRunning:
+			if atomic.CompareAndSwapInt32(&d.state, drainRunning, drainAgain) {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (d *drainer) run() {
+	for {
+		d.drain()
+		if atomic.CompareAndSwapInt32(&d.state, drainRunning, drainIdle) {
+			return
+		}
+
+		atomic.StoreInt32(&d.state, drainRunning)
+	}
+}
+
 func NewSimpleLimiter(id string, limitAlgorithm limits.Limit) limits.Limiter {
 	return &simpleLimiter{
 		id:             id,
@@ -28,14 +94,14 @@ type simpleLimiter struct {
 	inFlight       int32
 }
 
-func (l *simpleLimiter) getInFlight() int {
-	return int(atomic.LoadInt32(&l.inFlight))
+func (l *simpleLimiter) NotifyChange(fn func(int)) {
+	l.limitAlgorithm.NotifyChange(fn)
 }
 
-func (l *simpleLimiter) createListener() limits.Listener {
+func (l *simpleLimiter) createListener(inFlight int) limits.Listener {
 	startTime := time.Now()
-	inFlight := int(atomic.AddInt32(&l.inFlight, 1))
-	return func(ctx context.Context, result limits.Result) {
+	return guardListener(func(ctx context.Context, result limits.Result) {
+		atomic.AddInt32(&l.inFlight, -1)
 		switch result {
 		case limits.SUCCESS:
 			l.limitAlgorithm.OnSample(ctx, startTime, time.Since(startTime), inFlight, false)
@@ -45,14 +111,22 @@ func (l *simpleLimiter) createListener() limits.Listener {
 		default:
 			// nerver reached path
 		}
-	}
+	})
 }
 
 func (l *simpleLimiter) Acquire(ctx context.Context) (limits.Listener, error) {
-	inFlight := l.getInFlight()
-	if inFlight < l.limitAlgorithm.GetLimit() {
-		return l.createListener(), nil
+	if bypassFromContext(ctx) {
+		return admitBypassed(), nil
 	}
 
-	return nil, errLimitExceeded
+	for {
+		inFlight := atomic.LoadInt32(&l.inFlight)
+		if int(inFlight) >= l.limitAlgorithm.GetLimit() {
+			return nil, errLimitExceeded
+		}
+
+		if atomic.CompareAndSwapInt32(&l.inFlight, inFlight, inFlight+1) {
+			return l.createListener(int(inFlight + 1)), nil
+		}
+	}
 }
@@ -0,0 +1,112 @@
+package limiter
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+	"github.com/xtracker/limits/limit"
+)
+
+func TestWaitingLimitersLimitIncrease(t *testing.T) {
+	waiting := map[string]func(limits.Limiter) limits.Limiter{
+		"priority": func(l limits.Limiter) limits.Limiter {
+			return NewPriorityLimiterBuilder(l).Timeout(time.Minute).Build()
+		},
+		"blocking": func(l limits.Limiter) limits.Limiter {
+			return NewBlockingLimiter(l, BlockingMaxWait(time.Minute))
+		},
+		"lifo": func(l limits.Limiter) limits.Limiter {
+			return NewLifoLimiterBuilder(l).Timeout(time.Minute).Build()
+		},
+		"wrapped": func(l limits.Limiter) limits.Limiter {
+			return NewBlockingLimiter(NewDeadlineLimiterBuilder(l).Build(), BlockingMaxWait(time.Minute))
+		},
+	}
+
+	for name, wrap := range waiting {
+		t.Run(name, func(t *testing.T) {
+			settable := limit.NewSettableLimit(1)
+			l := wrap(NewSimpleLimiter("", settable))
+			ctx := context.Background()
+
+			holder, err := l.Acquire(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			const waiters = 10
+			grants := make(chan grant, waiters)
+			hold := make(chan struct{})
+			for id := 1; id <= waiters; id++ {
+				go func(id int) {
+					listener, err := l.Acquire(ctx)
+					grants <- grant{id, err}
+					if err == nil {
+						<-hold
+						listener(ctx, limits.SUCCESS)
+					}
+				}(id)
+			}
+			time.Sleep(20 * time.Millisecond)
+
+			// the headroom of 9 permits is handed out without any release
+			settable.SetLimit(10)
+			for i := 0; i < waiters-1; i++ {
+				select {
+				case g := <-grants:
+					if g.err != nil {
+						t.Fatalf("unexpected error %v", g.err)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("expected %d waiters to be granted, got %d", waiters-1, i)
+				}
+			}
+
+			select {
+			case g := <-grants:
+				t.Fatalf("expected the limit to be honoured, waiter %d was granted", g.id)
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			holder(ctx, limits.SUCCESS)
+			if g := <-grants; g.err != nil {
+				t.Fatalf("unexpected error %v", g.err)
+			}
+			close(hold)
+		})
+	}
+}
+
+func TestDrainer(t *testing.T) {
+	var drains int32
+	block := make(chan struct{})
+	done := make(chan struct{}, 2)
+	d := &drainer{drain: func() {
+		atomic.AddInt32(&drains, 1)
+		<-block
+		done <- struct{}{}
+	}}
+
+	d.onChange(2)
+	// the growths during the drain are coalesced, decreases are ignored
+	d.onChange(3)
+	d.onChange(4)
+	d.onChange(1)
+	d.onChange(1)
+	block <- struct{}{}
+	<-done
+	block <- struct{}{}
+	<-done
+
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&drains); n != 2 {
+		t.Fatalf("expected 2 drains, got %d", n)
+	}
+
+	if state := atomic.LoadInt32(&d.state); state != drainIdle {
+		t.Fatalf("expected the drainer to be idle, got %d", state)
+	}
+}
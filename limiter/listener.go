@@ -0,0 +1,112 @@
+package limiter
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xtracker/limits"
+)
+
+type Misuse int
+
+const (
+	DoubleRelease  Misuse = iota // a listener was called more than once, later calls are ignored
+	LeakedListener               // a listener was garbage collected without being called, its permit is lost
+)
+
+func (m Misuse) String() string {
+	switch m {
+	case DoubleRelease:
+		return "double_release"
+	case LeakedListener:
+		return "leaked_listener"
+	default:
+		return "unknown"
+	}
+}
+
+type misuseHook struct {
+	fn func(Misuse)
+}
+
+var (
+	hooksMu       sync.Mutex   // serializes the writers of misuseHooks
+	misuseHooks   atomic.Value // []*misuseHook, copied on write
+	leakDetection int32
+)
+
+// OnMisuse adds a hook listener misuse is reported to, every hook is called in the order they
+// were added. Hooks are shared by all the limiters of the process, so a library should remove
+// its hook with the returned func once it is done.
+func OnMisuse(hook func(Misuse)) (remove func()) {
+	h := &misuseHook{fn: hook}
+
+	hooksMu.Lock()
+	hooks, _ := misuseHooks.Load().([]*misuseHook)
+	misuseHooks.Store(append(hooks[:len(hooks):len(hooks)], h))
+	hooksMu.Unlock()
+
+	return func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+
+		hooks, _ := misuseHooks.Load().([]*misuseHook)
+		kept := make([]*misuseHook, 0, len(hooks))
+		for _, other := range hooks {
+			if other != h {
+				kept = append(kept, other)
+			}
+		}
+		misuseHooks.Store(kept)
+	}
+}
+
+// EnableLeakDetection makes the listeners created afterwards report LeakedListener when they are
+// collected without being called. It relies on finalizers, so it costs an allocation per listener
+// and reports late. With wrapping limiters, a leak is reported by every limiter of the chain.
+func EnableLeakDetection(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&leakDetection, 1)
+	} else {
+		atomic.StoreInt32(&leakDetection, 0)
+	}
+}
+
+func reportMisuse(m Misuse) {
+	hooks, _ := misuseHooks.Load().([]*misuseHook)
+	for _, h := range hooks {
+		h.fn(m)
+	}
+}
+
+type guard struct {
+	listener limits.Listener
+	called   int32
+}
+
+func (g *guard) release(ctx context.Context, result limits.Result) {
+	if !atomic.CompareAndSwapInt32(&g.called, 0, 1) {
+		reportMisuse(DoubleRelease)
+		return
+	}
+
+	g.listener(ctx, result)
+}
+
+func finalizeGuard(g *guard) {
+	if atomic.LoadInt32(&g.called) == 0 {
+		reportMisuse(LeakedListener)
+	}
+}
+
+// guardListener makes listener idempotent, only the first call releases the permit
+func guardListener(listener limits.Listener) limits.Listener {
+	g := &guard{listener: listener}
+	if atomic.LoadInt32(&leakDetection) == 1 {
+		runtime.SetFinalizer(g, finalizeGuard)
+	}
+
+	return g.release
+}
@@ -0,0 +1,122 @@
+package limiter
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+	"github.com/xtracker/limits/limit"
+)
+
+// recordMisuse installs a hook counting reported misuse until the test ends
+func recordMisuse(t *testing.T) *[2]int32 {
+	var counts [2]int32
+	remove := OnMisuse(func(m Misuse) {
+		atomic.AddInt32(&counts[m], 1)
+	})
+	t.Cleanup(remove)
+	return &counts
+}
+
+func TestOnMisuseHooks(t *testing.T) {
+	first := recordMisuse(t)
+	second := recordMisuse(t)
+
+	reportMisuse(DoubleRelease)
+	if first[DoubleRelease] != 1 || second[DoubleRelease] != 1 {
+		t.Fatalf("expected both hooks to be called, got %v and %v", *first, *second)
+	}
+
+	removed := OnMisuse(func(Misuse) { t.Fatal("removed hook was called") })
+	removed()
+	removed()
+
+	reportMisuse(DoubleRelease)
+	if first[DoubleRelease] != 2 || second[DoubleRelease] != 2 {
+		t.Fatalf("expected the remaining hooks to be called, got %v and %v", *first, *second)
+	}
+}
+
+func TestSimpleLimiterReleases(t *testing.T) {
+	l := NewSimpleLimiter("", limit.FixedLimit(2))
+	ctx := context.Background()
+
+	for i := 0; i < 100; i++ {
+		listeners := acquireN(t, l, ctx, 2)
+		if _, err := l.Acquire(ctx); err == nil {
+			t.Fatalf("round %d: expected the limit to be reached", i)
+		}
+
+		for _, listener := range listeners {
+			listener(ctx, limits.SUCCESS)
+		}
+	}
+}
+
+func TestListenerDoubleRelease(t *testing.T) {
+	newSimple := func() limits.Limiter { return NewSimpleLimiter("", limit.FixedLimit(2)) }
+	limiters := map[string]limits.Limiter{
+		"simple":      newSimple(),
+		"priority":    NewPriorityLimiterBuilder(newSimple()).Timeout(time.Millisecond).Build(),
+		"blocking":    NewBlockingLimiter(newSimple(), BlockingMaxWait(time.Millisecond)),
+		"lifo":        NewLifoLimiterBuilder(newSimple()).Timeout(time.Millisecond).Build(),
+		"deadline":    NewDeadlineLimiterBuilder(newSimple()).Build(),
+		"partitioned": NewPartitionedLimiterBuilder("", limit.FixedLimit(2)).Build(),
+	}
+
+	for name, l := range limiters {
+		t.Run(name, func(t *testing.T) {
+			counts := recordMisuse(t)
+			ctx := context.Background()
+
+			listener, err := l.Acquire(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			listener(ctx, limits.SUCCESS)
+			listener(ctx, limits.SUCCESS)
+
+			if n := atomic.LoadInt32(&counts[DoubleRelease]); n != 1 {
+				t.Fatalf("expected 1 double release report, got %d", n)
+			}
+
+			// the second call must not have released a permit held by someone else
+			acquireN(t, l, ctx, 2)
+			if _, err := l.Acquire(ctx); err == nil {
+				t.Fatal("expected the limit to be reached")
+			}
+		})
+	}
+}
+
+func TestListenerLeakDetection(t *testing.T) {
+	counts := recordMisuse(t)
+	EnableLeakDetection(true)
+	t.Cleanup(func() { EnableLeakDetection(false) })
+
+	l := NewSimpleLimiter("", limit.FixedLimit(2))
+	func() {
+		if _, err := l.Acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// a released listener is not reported
+	listener, _ := l.Acquire(context.Background())
+	listener(context.Background(), limits.SUCCESS)
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+		runtime.GC()
+		if atomic.LoadInt32(&counts[LeakedListener]) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := atomic.LoadInt32(&counts[LeakedListener]); n != 1 {
+		t.Fatalf("expected 1 leaked listener report, got %d", n)
+	}
+}
@@ -0,0 +1,182 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+var _ limits.Limiter = (*partitionedLimiter)(nil)
+
+type partitionCtxKey struct{}
+
+// WithPartition marks the request as belonging to the named partition
+func WithPartition(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, partitionCtxKey{}, name)
+}
+
+func partitionFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(partitionCtxKey{}).(string)
+	return name
+}
+
+type partitionedLimiterBuilder struct {
+	id       string
+	limit    limits.Limit
+	names    []string
+	percents map[string]float64
+	resolver func(context.Context) string
+}
+
+func NewPartitionedLimiterBuilder(id string, limitAlgorithm limits.Limit) *partitionedLimiterBuilder {
+	return &partitionedLimiterBuilder{
+		id:       id,
+		limit:    limitAlgorithm,
+		percents: make(map[string]float64),
+		resolver: partitionFromContext,
+	}
+}
+
+// Partition guarantees percent(0, 1] of the limit to the named partition
+func (pb *partitionedLimiterBuilder) Partition(name string, percent float64) *partitionedLimiterBuilder {
+	if _, ok := pb.percents[name]; !ok {
+		pb.names = append(pb.names, name)
+	}
+
+	pb.percents[name] = percent
+	return pb
+}
+
+// Resolver maps a request to its partition name, WithPartition is used by default.
+// Requests of unknown partitions only get capacity that no partition is using.
+func (pb *partitionedLimiterBuilder) Resolver(resolver func(context.Context) string) *partitionedLimiterBuilder {
+	pb.resolver = resolver
+	return pb
+}
+
+func (pb *partitionedLimiterBuilder) validate() error {
+	if pb.resolver == nil {
+		return fmt.Errorf("partitioned: resolver must not be nil")
+	}
+
+	sum := 0.0
+	for _, name := range pb.names {
+		percent := pb.percents[name]
+		if percent <= 0 || percent > 1 {
+			return fmt.Errorf("partitioned: percent %v of partition %q must be in (0, 1]", percent, name)
+		}
+		sum += percent
+	}
+
+	if sum > 1+1e-9 {
+		return fmt.Errorf("partitioned: sum of partition percents %v exceeds 1", sum)
+	}
+
+	return nil
+}
+
+func (pb *partitionedLimiterBuilder) Build() limits.Limiter {
+	if err := pb.validate(); err != nil {
+		panic(err)
+	}
+
+	l := &partitionedLimiter{
+		id:             pb.id,
+		limitAlgorithm: pb.limit,
+		resolver:       pb.resolver,
+		partitions:     make(map[string]*partition, len(pb.names)),
+	}
+
+	for _, name := range pb.names {
+		l.partitions[name] = &partition{name: name, percent: pb.percents[name]}
+	}
+
+	l.updateLimits(pb.limit.GetLimit())
+	pb.limit.NotifyChange(l.updateLimits)
+	return l
+}
+
+type partition struct {
+	name    string
+	percent float64
+	limit   int
+	busy    int
+}
+
+func (p *partition) exceeded() bool {
+	return p.busy >= p.limit
+}
+
+// partitionedLimiter shares one limit between partitions. A partition may borrow
+// capacity while the limit is not reached, once it is, only partitions below
+// their share are admitted.
+type partitionedLimiter struct {
+	sync.Mutex
+	id             string
+	limitAlgorithm limits.Limit
+	resolver       func(context.Context) string
+	partitions     map[string]*partition
+	inFlight       int
+}
+
+func (l *partitionedLimiter) updateLimits(limit int) {
+	l.Lock()
+	defer l.Unlock()
+
+	for _, p := range l.partitions {
+		p.limit = int(math.Max(1, math.Ceil(float64(limit)*p.percent)))
+	}
+}
+
+func (l *partitionedLimiter) NotifyChange(fn func(int)) {
+	l.limitAlgorithm.NotifyChange(fn)
+}
+
+func (l *partitionedLimiter) Acquire(ctx context.Context) (limits.Listener, error) {
+	if bypassFromContext(ctx) {
+		return admitBypassed(), nil
+	}
+
+	p := l.partitions[l.resolver(ctx)]
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.inFlight >= l.limitAlgorithm.GetLimit() && (p == nil || p.exceeded()) {
+		return nil, errLimitExceeded
+	}
+
+	return l.createListener(p), nil
+}
+
+func (l *partitionedLimiter) createListener(p *partition) limits.Listener {
+	startTime := time.Now()
+	l.inFlight++
+	inFlight := l.inFlight
+	if p != nil {
+		p.busy++
+	}
+
+	return guardListener(func(ctx context.Context, result limits.Result) {
+		l.Lock()
+		l.inFlight--
+		if p != nil {
+			p.busy--
+		}
+		l.Unlock()
+
+		switch result {
+		case limits.SUCCESS:
+			l.limitAlgorithm.OnSample(ctx, startTime, time.Since(startTime), inFlight, false)
+		case limits.DROPPED:
+			l.limitAlgorithm.OnSample(ctx, startTime, time.Since(startTime), inFlight, true)
+		case limits.IGNORED:
+		default:
+			// never reached path
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xtracker/limits"
+	"github.com/xtracker/limits/limit"
+)
+
+func acquireN(t *testing.T, l limits.Limiter, ctx context.Context, n int) []limits.Listener {
+	t.Helper()
+
+	listeners := make([]limits.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		listener, err := l.Acquire(ctx)
+		if err != nil {
+			t.Fatalf("acquire %d: unexpected error %v", i, err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	return listeners
+}
+
+func TestPartitionedLimiter(t *testing.T) {
+	l := NewPartitionedLimiterBuilder("test", limit.FixedLimit(10)).
+		Partition("batch", 0.3).
+		Partition("interactive", 0.7).
+		Build()
+
+	batch := WithPartition(context.Background(), "batch")
+	interactive := WithPartition(context.Background(), "interactive")
+
+	// batch borrows the idle capacity of interactive
+	batchListeners := acquireN(t, l, batch, 10)
+	if _, err := l.Acquire(batch); err == nil {
+		t.Fatal("expected batch to be rejected once the limit is reached")
+	}
+
+	if _, err := l.Acquire(context.Background()); err == nil {
+		t.Fatal("expected unpartitioned request to be rejected once the limit is reached")
+	}
+
+	// interactive still gets its guaranteed share
+	acquireN(t, l, interactive, 7)
+	if _, err := l.Acquire(interactive); err == nil {
+		t.Fatal("expected interactive to be rejected beyond its share")
+	}
+
+	for _, listener := range batchListeners {
+		listener(batch, limits.IGNORED)
+	}
+
+	// interactive now borrows the capacity released by batch
+	acquireN(t, l, interactive, 3)
+	if _, err := l.Acquire(interactive); err == nil {
+		t.Fatal("expected interactive to be rejected once the limit is reached")
+	}
+
+	acquireN(t, l, batch, 3)
+}
+
+type classKey struct{}
+
+func TestPartitionedLimiterLimitChange(t *testing.T) {
+	settable := limit.NewSettableLimit(10)
+	l := NewPartitionedLimiterBuilder("test", settable).
+		Partition("batch", 0.3).
+		Partition("interactive", 0.7).
+		Resolver(func(ctx context.Context) string {
+			name, _ := ctx.Value(classKey{}).(string)
+			return name
+		}).
+		Build().(*partitionedLimiter)
+
+	settable.SetLimit(20)
+	if batch, interactive := l.partitions["batch"].limit, l.partitions["interactive"].limit; batch != 6 || interactive != 14 {
+		t.Fatalf("expected partition limits 6/14, got %d/%d", batch, interactive)
+	}
+
+	interactive := context.WithValue(context.Background(), classKey{}, "interactive")
+	acquireN(t, l, context.Background(), 20)
+	acquireN(t, l, interactive, 14)
+	if _, err := l.Acquire(interactive); err == nil {
+		t.Fatal("expected interactive to be rejected beyond its share")
+	}
+}
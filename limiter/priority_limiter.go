@@ -3,6 +3,7 @@ package limiter
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,9 +14,14 @@ import (
 
 var _ limits.Limiter = (*priorityLimiter)(nil)
 
+// ErrEvicted is returned to a waiter evicted from a full backlog by a waiter to be served before it
+var ErrEvicted = errors.New("limits error: evicted from backlog")
+
+// ErrShed is returned to a waiter shed from a standing backlog by CoDel
+var ErrShed = errors.New("limits error: shed from a standing backlog")
+
 var (
 	errBacklogOverload = errors.New("backlog overload")
-	errEvicted         = errors.New("evicted by higher priority")
 	errTimeout         = errors.New("wait timeout")
 )
 
@@ -24,12 +30,41 @@ type eventData struct {
 	err      error
 }
 
+// Discipline is the order in which the backlog of a priority limiter is served
+type Discipline int
+
+const (
+	PriorityLifo          Discipline = iota // higher priority first, the newest waiter first within a priority
+	PriorityFifo                            // higher priority first, the oldest waiter first within a priority
+	Fifo                                    // the oldest waiter first, priority is ignored
+	EarliestDeadlineFirst                   // the waiter with the earliest deadline first, priority is ignored
+	Lifo                                    // the newest waiter first, priority is ignored
+)
+
+func (d Discipline) String() string {
+	switch d {
+	case PriorityLifo:
+		return "priority_lifo"
+	case PriorityFifo:
+		return "priority_fifo"
+	case Fifo:
+		return "fifo"
+	case EarliestDeadlineFirst:
+		return "edf"
+	case Lifo:
+		return "lifo"
+	default:
+		return "unknown"
+	}
+}
+
 type event struct {
-	priority int
-	c        chan eventData
-	ctx      context.Context
-	fifo     bool
-	done     int32
+	priority   int
+	c          chan eventData
+	ctx        context.Context
+	arrival    time.Time
+	discipline Discipline
+	done       int32
 }
 
 func (e *event) Done() bool {
@@ -42,20 +77,27 @@ func (e *event) cancel() {
 
 func (e *event) Less(other util.Comparable) bool {
 	oe := other.(*event)
-	di, _ := e.ctx.Deadline()
-	dj, _ := oe.ctx.Deadline()
 
-	// fifo mode:
-	if e.fifo {
+	switch e.discipline {
+	case Fifo:
+		return e.arrival.Before(oe.arrival)
+	case Lifo:
+		return e.arrival.After(oe.arrival)
+	case EarliestDeadlineFirst:
+		di, _ := e.ctx.Deadline()
+		dj, _ := oe.ctx.Deadline()
 		return di.Before(dj)
 	}
 
-	// priority & lifo mode
-	if e.priority == oe.priority {
-		return di.After(dj)
+	if e.priority != oe.priority {
+		return e.priority > oe.priority
 	}
 
-	return e.priority > oe.priority
+	if e.discipline == PriorityFifo {
+		return e.arrival.Before(oe.arrival)
+	}
+
+	return e.arrival.After(oe.arrival)
 }
 
 func (e *event) signal(listener limits.Listener, err error) bool {
@@ -76,11 +118,26 @@ func WithPriority(ctx context.Context, priority int) context.Context {
 	return context.WithValue(ctx, priorityCtxKey{}, priority)
 }
 
+// PriorityFromContext returns the priority set by WithPriority
+func PriorityFromContext(ctx context.Context) (int, bool) {
+	priority, ok := ctx.Value(priorityCtxKey{}).(int)
+	return priority, ok
+}
+
 type priorityLimiterBuilder struct {
 	id          string
 	delegate    limits.Limiter
 	backlogSize int
 	timeout     time.Duration
+	discipline  Discipline
+
+	fairQueuing   bool
+	defaultWeight float64
+	weights       map[string]float64
+
+	aging map[int]time.Duration
+
+	codelTarget, codelInterval time.Duration
 }
 
 func NewPriorityLimiterBuilder(delegate limits.Limiter) *priorityLimiterBuilder {
@@ -89,6 +146,8 @@ func NewPriorityLimiterBuilder(delegate limits.Limiter) *priorityLimiterBuilder
 		backlogSize: 64,
 		timeout:     time.Second,
 		delegate:    delegate,
+		weights:     make(map[string]float64),
+		aging:       make(map[int]time.Duration),
 	}
 }
 
@@ -102,42 +161,161 @@ func (pb *priorityLimiterBuilder) Timeout(timeout time.Duration) *priorityLimite
 	return pb
 }
 
+// Discipline selects the order waiters are served in, PriorityLifo by default.
+// When the backlog is full, the waiter that would be served last is evicted, or rejected if it is the newcomer.
+func (pb *priorityLimiterBuilder) Discipline(discipline Discipline) *priorityLimiterBuilder {
+	pb.discipline = discipline
+	return pb
+}
+
+// FairQueuing shares the backlog of every priority between the tenants set by WithTenant,
+// in proportion to their weights. Tenants without a weight get defaultWeight, a tenant with
+// weight 2 is served twice as many waiters as one with weight 1 while both are waiting.
+func (pb *priorityLimiterBuilder) FairQueuing(defaultWeight float64) *priorityLimiterBuilder {
+	pb.fairQueuing = true
+	pb.defaultWeight = defaultWeight
+	return pb
+}
+
+// TenantWeight sets the weight of tenant, it has no effect without FairQueuing
+func (pb *priorityLimiterBuilder) TenantWeight(tenant string, weight float64) *priorityLimiterBuilder {
+	pb.weights[tenant] = weight
+	return pb
+}
+
+// Aging raises the priority of the waiters of priority by one every interval they wait,
+// so they are eventually served under sustained load of higher priorities
+func (pb *priorityLimiterBuilder) Aging(priority int, interval time.Duration) *priorityLimiterBuilder {
+	pb.aging[priority] = interval
+	return pb
+}
+
+// CoDel sheds the waiters of a standing backlog. When no waiter is served within target for
+// a whole interval, the waiters that waited longer than target are rejected, instead of
+// waiting for the timeout, until a waiter is served within target again.
+func (pb *priorityLimiterBuilder) CoDel(target, interval time.Duration) *priorityLimiterBuilder {
+	pb.codelTarget, pb.codelInterval = target, interval
+	return pb
+}
+
+func (pb *priorityLimiterBuilder) validate() error {
+	if pb.codelTarget < 0 || pb.codelInterval < 0 || (pb.codelTarget == 0) != (pb.codelInterval == 0) {
+		return fmt.Errorf("priority: codel target %v and interval %v must be positive", pb.codelTarget, pb.codelInterval)
+	}
+
+	for priority, interval := range pb.aging {
+		if interval <= 0 {
+			return fmt.Errorf("priority: aging interval %v of priority %d must be positive", interval, priority)
+		}
+	}
+
+	if len(pb.aging) > 0 && pb.discipline != PriorityLifo && pb.discipline != PriorityFifo {
+		return fmt.Errorf("priority: aging requires a priority discipline, got %v", pb.discipline)
+	}
+
+	if !pb.fairQueuing {
+		return nil
+	}
+
+	if pb.defaultWeight <= 0 {
+		return fmt.Errorf("priority: default tenant weight %v must be positive", pb.defaultWeight)
+	}
+
+	for tenant, weight := range pb.weights {
+		if weight <= 0 {
+			return fmt.Errorf("priority: weight %v of tenant %q must be positive", weight, tenant)
+		}
+	}
+
+	return nil
+}
+
 func (pb *priorityLimiterBuilder) Build() limits.Limiter {
-	return &priorityLimiter{
-		Limiter: pb.delegate,
-		id:      pb.id,
-		timeout: pb.timeout,
-		backlog: util.NewPriorityDeque[*event](pb.backlogSize),
+	if err := pb.validate(); err != nil {
+		panic(err)
+	}
+
+	aging := make(map[int]time.Duration, len(pb.aging))
+	for priority, interval := range pb.aging {
+		aging[priority] = interval
+	}
+
+	var b backlog = util.NewPriorityDeque[*event](pb.backlogSize)
+	switch {
+	case pb.fairQueuing:
+		weights := make(map[string]float64, len(pb.weights))
+		for tenant, weight := range pb.weights {
+			weights[tenant] = weight
+		}
+		fb := newFairBacklog(pb.backlogSize, pb.discipline, weights, pb.defaultWeight)
+		fb.aging = aging
+		b = fb
+	case len(aging) > 0:
+		b = newAgingBacklog(pb.backlogSize, pb.discipline, aging)
 	}
+
+	var c *codel
+	if pb.codelTarget > 0 {
+		c = &codel{target: pb.codelTarget, interval: pb.codelInterval}
+	}
+
+	p := &priorityLimiter{
+		Limiter:    pb.delegate,
+		id:         pb.id,
+		timeout:    pb.timeout,
+		discipline: pb.discipline,
+		backlog:    b,
+		codel:      c,
+	}
+
+	drainOnGrowth(pb.delegate, p.drain)
+	return p
 }
 
 type priorityLimiter struct {
 	limits.Limiter
 	sync.Mutex
-	id      string
-	timeout time.Duration
-	backlog util.Deque[*event]
+	id         string
+	timeout    time.Duration
+	discipline Discipline
+	backlog    backlog
+	codel      *codel // nil unless enabled
+}
+
+func (p *priorityLimiter) NotifyChange(fn func(int)) {
+	notifyChange(p.Limiter, fn)
 }
 
 func (p *priorityLimiter) Acquire(ctx context.Context) (limits.Listener, error) {
-	listener, err := p.tryAcquire(ctx)
-	if err == nil {
-		return listener, nil
+	if bypassFromContext(ctx) {
+		return admitBypassed(), nil
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, p.timeout)
 	defer cancel()
 
-	priority, _ := ctx.Value(priorityCtxKey{}).(int)
+	priority, _ := PriorityFromContext(ctx)
 	ev := &event{
-		ctx:      ctx,
-		priority: priority,
-		c:        make(chan eventData),
+		ctx:        ctx,
+		priority:   priority,
+		c:          make(chan eventData),
+		arrival:    time.Now(),
+		discipline: p.discipline,
 	}
 
 	defer ev.cancel()
 
+	// try and enqueue under the same lock as signal, a release can't slip in between.
+	// a newcomer only bypasses the backlog when nobody is waiting, or it could take
+	// a released permit before signal hands it to the first waiter
 	p.Lock()
+	if !p.hasWaiter() {
+		if listener, err := p.tryAcquire(ctx); err == nil {
+			p.Unlock()
+			return listener, nil
+		}
+	}
+
 	outdated, ok := p.backlog.Offer(ev)
 	p.Unlock()
 
@@ -146,7 +324,7 @@ func (p *priorityLimiter) Acquire(ctx context.Context) (limits.Listener, error)
 	}
 
 	if outdated != nil {
-		outdated.signal(nil, errEvicted)
+		outdated.signal(nil, ErrEvicted)
 	}
 
 	select {
@@ -157,43 +335,82 @@ func (p *priorityLimiter) Acquire(ctx context.Context) (limits.Listener, error)
 	}
 }
 
+// hasWaiter drops the waiters at the front that already gave up and reports whether one is left
+func (p *priorityLimiter) hasWaiter() bool {
+	for ev, ok := p.backlog.PeekFirst(); ok; ev, ok = p.backlog.PeekFirst() {
+		if !ev.Done() {
+			return true
+		}
+		p.backlog.PollFirst()
+	}
+
+	return false
+}
+
 func (p *priorityLimiter) tryAcquire(ctx context.Context) (limits.Listener, error) {
 	listener, err := p.Limiter.Acquire(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return func(ctx context.Context, result limits.Result) {
+	return guardListener(func(ctx context.Context, result limits.Result) {
 		listener(ctx, result)
 		p.signal(ctx)
-	}, nil
+	}), nil
 }
 
-func (p *priorityLimiter) signal(context.Context) {
+// signal hands a permit to the first waiter, it returns false if there was no waiter or no permit
+func (p *priorityLimiter) signal(context.Context) bool {
 	p.Lock()
+	now := time.Now()
 	candidate, ok := p.backlog.PeekFirst()
 	timeout := 0
+	var shed []*event
 
-	for ; ok && candidate.Done(); candidate, ok = p.backlog.PeekFirst() {
+	for ; ok && (candidate.Done() || p.codel != nil && p.codel.shed(now, candidate)); candidate, ok = p.backlog.PeekFirst() {
+		if !candidate.Done() {
+			shed = append(shed, candidate)
+		}
 		timeout++
 		p.backlog.PollFirst()
 	}
 
+	// signal the shed waiters outside of the lock
+	defer func() {
+		for _, ev := range shed {
+			ev.signal(nil, ErrShed)
+		}
+	}()
+
 	if !ok {
+		if p.codel != nil {
+			p.codel.observe(now, 0)
+		}
 		p.Unlock()
-		return
+		return false
 	}
 
 	listener, err := p.tryAcquire(candidate.ctx)
 	if err == nil {
 		p.backlog.PollFirst()
+		if p.codel != nil {
+			p.codel.observe(now, now.Sub(candidate.arrival))
+		}
 		p.Unlock()
 		if !candidate.signal(listener, nil) {
 			// it is possible that the wait request already timeout,
 			// release the limit directly, or there will be a limit leak
 			listener(candidate.ctx, limits.IGNORED)
 		}
-	} else {
-		p.Unlock()
+		return true
+	}
+
+	p.Unlock()
+	return false
+}
+
+// drain serves as many waiters as the delegate admits
+func (p *priorityLimiter) drain() {
+	for p.signal(context.Background()) {
 	}
 }
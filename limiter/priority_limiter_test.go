@@ -2,9 +2,11 @@ package limiter
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/xtracker/limits"
 	"github.com/xtracker/limits/limit"
 )
 
@@ -33,3 +35,152 @@ func TestPriorityLimiter(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestPriorityLimiterDiscipline(t *testing.T) {
+	// waiters enqueued in id order
+	waiters := []struct {
+		priority int
+		timeout  time.Duration
+	}{
+		{0, 2 * time.Second},
+		{1, 3 * time.Second},
+		{0, time.Second},
+		{1, 1500 * time.Millisecond},
+	}
+
+	cases := []struct {
+		discipline Discipline
+		expected   []int
+	}{
+		{Fifo, []int{1, 2, 3, 4}},
+		{PriorityFifo, []int{2, 4, 1, 3}},
+		{PriorityLifo, []int{4, 2, 3, 1}},
+		{EarliestDeadlineFirst, []int{3, 4, 1, 2}},
+		{Lifo, []int{4, 3, 2, 1}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.discipline.String(), func(t *testing.T) {
+			l := NewPriorityLimiterBuilder(&semaphoreLimiter{max: 1}).
+				Discipline(c.discipline).
+				Timeout(time.Minute).
+				Build()
+
+			holder, err := l.Acquire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			grants := make(chan grant, len(waiters))
+			hold := make(chan struct{})
+			for i, w := range waiters {
+				ctx, cancel := context.WithTimeout(WithPriority(context.Background(), w.priority), w.timeout)
+				defer cancel()
+				enqueue(l, ctx, i+1, grants, hold)
+			}
+
+			holder(context.Background(), limits.SUCCESS)
+			for _, expected := range c.expected {
+				g := <-grants
+				if g.id != expected || g.err != nil {
+					t.Fatalf("expected waiter %d to be granted, got %+v", expected, g)
+				}
+				hold <- struct{}{}
+			}
+		})
+	}
+}
+
+// hookLimiter calls onRelease once a permit of the delegate is released
+type hookLimiter struct {
+	limits.Limiter
+	onRelease func()
+}
+
+func (h *hookLimiter) Acquire(ctx context.Context) (limits.Listener, error) {
+	listener, err := h.Limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, result limits.Result) {
+		listener(ctx, result)
+		if h.onRelease != nil {
+			h.onRelease()
+		}
+	}, nil
+}
+
+func TestPriorityLimiterNewcomer(t *testing.T) {
+	delegate := &hookLimiter{Limiter: &semaphoreLimiter{max: 1}}
+	l := NewPriorityLimiterBuilder(delegate).Discipline(Fifo).Timeout(time.Minute).Build()
+
+	holder, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grants := make(chan grant, 2)
+	hold := make(chan struct{})
+	enqueue(l, context.Background(), 1, grants, hold)
+
+	// the newcomer arrives after the permit is released but before it is handed to the waiter
+	delegate.onRelease = func() {
+		delegate.onRelease = nil
+		enqueue(l, context.Background(), 2, grants, hold)
+	}
+	holder(context.Background(), limits.SUCCESS)
+
+	for _, expected := range []int{1, 2} {
+		g := <-grants
+		if g.id != expected || g.err != nil {
+			t.Fatalf("expected waiter %d to be granted, got %+v", expected, g)
+		}
+		hold <- struct{}{}
+	}
+}
+
+func TestPriorityLimiterAging(t *testing.T) {
+	for _, aging := range []bool{false, true} {
+		b := NewPriorityLimiterBuilder(&semaphoreLimiter{max: 1}).
+			Discipline(PriorityFifo).
+			Timeout(300 * time.Millisecond)
+		if aging {
+			b.Aging(0, 20*time.Millisecond)
+		}
+		l := b.Build()
+
+		// saturate the limiter with high priority requests
+		ctx, cancel := context.WithCancel(WithPriority(context.Background(), 1))
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ctx.Err() == nil {
+					if listener, err := l.Acquire(ctx); err == nil {
+						time.Sleep(2 * time.Millisecond)
+						listener(ctx, limits.SUCCESS)
+					}
+				}
+			}()
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		start := time.Now()
+		listener, err := l.Acquire(context.Background())
+		waited := time.Since(start)
+		if err == nil {
+			listener(context.Background(), limits.SUCCESS)
+		}
+		cancel()
+		wg.Wait()
+
+		switch {
+		case !aging && err != errTimeout:
+			t.Fatalf("expected the low priority waiter to starve, got %v after %v", err, waited)
+		case aging && (err != nil || waited > 150*time.Millisecond):
+			t.Fatalf("expected the low priority waiter to be served within 150ms, got %v after %v", err, waited)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+type Policy int
+
+const (
+	PolicyClose Policy = iota // accept and immediately close excess connections
+	PolicyHold                // hold excess connections until a permit is available
+)
+
+type listenerBuilder struct {
+	limiter limits.Limiter
+	policy  Policy
+	retry   time.Duration
+}
+
+// NewListenerBuilder limits the number of open connections with l, a connection holds
+// its permit until it is closed so the sample rtt is the connection lifetime
+func NewListenerBuilder(l limits.Limiter) *listenerBuilder {
+	return &listenerBuilder{
+		limiter: l,
+		policy:  PolicyClose,
+		retry:   100 * time.Millisecond,
+	}
+}
+
+func (lb *listenerBuilder) Policy(policy Policy) *listenerBuilder {
+	lb.policy = policy
+	return lb
+}
+
+// HoldRetry is how often a held connection retries to acquire a permit, besides
+// retrying whenever a connection is closed. It catches permits freed by limit changes.
+func (lb *listenerBuilder) HoldRetry(retry time.Duration) *listenerBuilder {
+	lb.retry = retry
+	return lb
+}
+
+func (lb *listenerBuilder) Build(inner net.Listener) net.Listener {
+	if lb.limiter == nil || lb.retry <= 0 {
+		panic("net: limiter must not be nil and hold retry must be positive")
+	}
+
+	return &listener{
+		Listener: inner,
+		limiter:  lb.limiter,
+		policy:   lb.policy,
+		retry:    lb.retry,
+		released: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+type listener struct {
+	net.Listener
+	limiter  limits.Limiter
+	policy   Policy
+	retry    time.Duration
+	released chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		permit, err := l.limiter.Acquire(context.Background())
+		if err != nil && l.policy == PolicyHold {
+			permit, err = l.wait()
+		}
+
+		if err != nil {
+			c.Close()
+			if l.policy == PolicyHold {
+				// only returned when the listener is closed while holding
+				return nil, err
+			}
+
+			continue
+		}
+
+		return &conn{Conn: c, listener: l, permit: permit}, nil
+	}
+}
+
+func (l *listener) wait() (limits.Listener, error) {
+	ticker := time.NewTicker(l.retry)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.released:
+		case <-ticker.C:
+		case <-l.done:
+			return nil, net.ErrClosed
+		}
+
+		if permit, err := l.limiter.Acquire(context.Background()); err == nil {
+			return permit, nil
+		}
+	}
+}
+
+func (l *listener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+
+	return l.Listener.Close()
+}
+
+func (l *listener) release() {
+	select {
+	case l.released <- struct{}{}:
+	default:
+	}
+}
+
+var errHalfCloseUnsupported = errors.New("net: the wrapped conn does not support half close")
+
+// conn keeps the permit of an accepted connection until it is closed. It forwards the
+// half close of *net.TCPConn and *net.UnixConn, the other methods of the wrapped conn
+// are reached through NetConn.
+type conn struct {
+	net.Conn
+	listener *listener
+	permit   limits.Listener
+	once     sync.Once
+}
+
+func (c *conn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.permit(context.Background(), limits.SUCCESS)
+		c.listener.release()
+	})
+
+	return err
+}
+
+// NetConn returns the wrapped conn, closing it directly does not release the permit
+func (c *conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *conn) CloseRead() error {
+	if cr, ok := c.Conn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+
+	return errHalfCloseUnsupported
+}
+
+func (c *conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+
+	return errHalfCloseUnsupported
+}
@@ -0,0 +1,182 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+// countingLimiter admits up to max requests and records the results
+type countingLimiter struct {
+	sync.Mutex
+	max      int
+	inFlight int
+	results  []limits.Result
+}
+
+func (c *countingLimiter) Acquire(context.Context) (limits.Listener, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.inFlight >= c.max {
+		return nil, errors.New("limit exceeded")
+	}
+
+	c.inFlight++
+	return func(_ context.Context, result limits.Result) {
+		c.Lock()
+		defer c.Unlock()
+
+		c.inFlight--
+		c.results = append(c.results, result)
+	}, nil
+}
+
+func listen(t *testing.T, builder *listenerBuilder) net.Listener {
+	t.Helper()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln := builder.Build(inner)
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+func dial(t *testing.T, ln net.Listener) net.Conn {
+	t.Helper()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func accept(ln net.Listener) <-chan net.Conn {
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			accepted <- c
+		}
+		close(accepted)
+	}()
+
+	return accepted
+}
+
+func TestListenerClosePolicy(t *testing.T) {
+	l := &countingLimiter{max: 1}
+	ln := listen(t, NewListenerBuilder(l))
+
+	dial(t, ln)
+	first := <-accept(ln)
+
+	// the excess connection is closed by the server, accept keeps waiting for the next one
+	excess := dial(t, ln)
+	accepted := accept(ln)
+	excess.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := excess.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected excess connection to be closed, got %v", err)
+	}
+
+	first.Close()
+	first.Close()
+	dial(t, ln)
+	if c := <-accepted; c == nil {
+		t.Fatal("expected a connection once the permit is released")
+	}
+
+	if len(l.results) != 1 || l.results[0] != limits.SUCCESS {
+		t.Fatalf("expected a single release, got %v", l.results)
+	}
+}
+
+func TestListenerHoldPolicy(t *testing.T) {
+	ln := listen(t, NewListenerBuilder(&countingLimiter{max: 1}).Policy(PolicyHold).HoldRetry(time.Hour))
+
+	dial(t, ln)
+	first := <-accept(ln)
+
+	dial(t, ln)
+	accepted := accept(ln)
+	select {
+	case <-accepted:
+		t.Fatal("expected the excess connection to be held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.Close()
+	select {
+	case c := <-accepted:
+		if c == nil {
+			t.Fatal("expected the held connection to be accepted")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("held connection was not accepted after a release")
+	}
+}
+
+func TestListenerHoldClosed(t *testing.T) {
+	ln := listen(t, NewListenerBuilder(&countingLimiter{max: 0}).Policy(PolicyHold))
+
+	dial(t, ln)
+	accepted := accept(ln)
+	time.Sleep(20 * time.Millisecond)
+	ln.Close()
+
+	select {
+	case c := <-accepted:
+		if c != nil {
+			t.Fatal("expected accept to fail once the listener is closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("accept is still holding after close")
+	}
+}
+
+func TestListenerCloseWrite(t *testing.T) {
+	ln := listen(t, NewListenerBuilder(&countingLimiter{max: 1}))
+
+	client := dial(t, ln)
+	server := <-accept(ln)
+
+	cw, ok := server.(interface{ CloseWrite() error })
+	if !ok {
+		t.Fatal("expected the conn to support half close")
+	}
+
+	if err := cw.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the client reads EOF but can still write to the server
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF after CloseWrite, got %v", err)
+	}
+
+	if _, err := client.Write([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := server.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("expected the read side to stay open, got %v", err)
+	}
+
+	if _, ok := server.(interface{ NetConn() net.Conn }).NetConn().(*net.TCPConn); !ok {
+		t.Fatal("expected NetConn to return the tcp conn")
+	}
+}
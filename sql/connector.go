@@ -0,0 +1,389 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/xtracker/limits"
+)
+
+var (
+	_ driver.Connector                      = (*connector)(nil)
+	_ io.Closer                             = (*connector)(nil)
+	_ driver.ExecerContext                  = (*conn)(nil)
+	_ driver.QueryerContext                 = (*conn)(nil)
+	_ driver.ConnPrepareContext             = (*conn)(nil)
+	_ driver.ConnBeginTx                    = (*conn)(nil)
+	_ driver.StmtExecContext                = (*stmt)(nil)
+	_ driver.StmtQueryContext               = (*stmt)(nil)
+	_ driver.ColumnConverter                = (*stmt)(nil)
+	_ driver.RowsNextResultSet              = (*rows)(nil)
+	_ driver.RowsColumnTypeScanType         = (*rows)(nil)
+	_ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+	_ driver.RowsColumnTypeLength           = (*rows)(nil)
+	_ driver.RowsColumnTypeNullable         = (*rows)(nil)
+	_ driver.RowsColumnTypePrecisionScale   = (*rows)(nil)
+)
+
+// LimitExceededError is returned instead of running a query when the limit is reached
+type LimitExceededError struct {
+	Err error
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("limits error: query limit exceeded: %v", e.Err)
+}
+
+func (e *LimitExceededError) Unwrap() error {
+	return e.Err
+}
+
+// NewConnector runs every query and exec of the connections of c through l, use it with sql.OpenDB.
+// A query holds its permit until its rows are closed.
+func NewConnector(c driver.Connector, l limits.Limiter) driver.Connector {
+	return &connector{
+		Connector: c,
+		limiter:   l,
+	}
+}
+
+type connector struct {
+	driver.Connector
+	limiter limits.Limiter
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dc, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn{Conn: dc, limiter: c.limiter}, nil
+}
+
+// Close is called by sql.DB.Close
+func (c *connector) Close() error {
+	if closer, ok := c.Connector.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// classify drops context cancellation and driver errors, ErrSkip only asks database/sql
+// to take another path so the call did not really happen
+func classify(err error) limits.Result {
+	switch {
+	case err == nil || err == io.EOF:
+		return limits.SUCCESS
+	case err == driver.ErrSkip:
+		return limits.IGNORED
+	default:
+		return limits.DROPPED
+	}
+}
+
+func acquire(ctx context.Context, l limits.Limiter) (limits.Listener, error) {
+	listener, err := l.Acquire(ctx)
+	if err != nil {
+		return nil, &LimitExceededError{Err: err}
+	}
+
+	return listener, nil
+}
+
+type conn struct {
+	driver.Conn
+	limiter limits.Limiter
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var ds driver.Stmt
+	var err error
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		ds, err = pc.PrepareContext(ctx, query)
+	} else {
+		ds, err = c.Conn.Prepare(query)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &stmt{Stmt: ds, conn: c.Conn, limiter: c.limiter}, nil
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if bt, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return bt.BeginTx(ctx, opts)
+	}
+
+	// the options are checked like database/sql does for drivers without BeginTx
+	if opts.Isolation != driver.IsolationLevel(0) {
+		return nil, errors.New("sql: driver does not support non-default isolation level")
+	}
+
+	if opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support read-only transactions")
+	}
+
+	return c.Conn.Begin()
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		// database/sql falls back to a prepared statement, which is limited as well
+		return nil, driver.ErrSkip
+	}
+
+	listener, err := acquire(ctx, c.limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := execer.ExecContext(ctx, query, args)
+	listener(ctx, classify(err))
+	return result, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	listener, err := acquire(ctx, c.limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	dr, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		listener(ctx, classify(err))
+		return nil, err
+	}
+
+	return &rows{Rows: dr, ctx: ctx, listener: listener}, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+
+	// use the default conversion
+	return driver.ErrSkip
+}
+
+type stmt struct {
+	driver.Stmt
+	conn    driver.Conn // the wrapped conn the stmt was prepared on
+	limiter limits.Limiter
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	listener, err := acquire(ctx, s.limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	var result driver.Result
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else if values, verr := namedValuesToValues(args); verr != nil {
+		err = verr
+	} else {
+		result, err = s.Stmt.Exec(values)
+	}
+
+	listener(ctx, classify(err))
+	return result, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	listener, err := acquire(ctx, s.limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	var dr driver.Rows
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		dr, err = queryer.QueryContext(ctx, args)
+	} else if values, verr := namedValuesToValues(args); verr != nil {
+		err = verr
+	} else {
+		dr, err = s.Stmt.Query(values)
+	}
+
+	if err != nil {
+		listener(ctx, classify(err))
+		return nil, err
+	}
+
+	return &rows{Rows: dr, ctx: ctx, listener: listener}, nil
+}
+
+// CheckNamedValue hides the checker of the conn from database/sql, which only asks the
+// conn when the stmt has none, so it asks the conn itself
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+
+	if checker, ok := s.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+
+	return driver.ErrSkip
+}
+
+// ColumnConverter falls back to the conversion database/sql uses by default
+func (s *stmt) ColumnConverter(idx int) driver.ValueConverter {
+	if cc, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return cc.ColumnConverter(idx)
+	}
+
+	return driver.DefaultParameterConverter
+}
+
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("sql: driver does not support named parameter %q", arg.Name)
+		}
+		values[i] = arg.Value
+	}
+
+	return values, nil
+}
+
+// rows releases the permit of its query when closed, a failed iteration drops the sample
+type rows struct {
+	driver.Rows
+	ctx      context.Context
+	listener limits.Listener
+	err      error
+	closed   bool
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+
+	return err
+}
+
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		if r.err == nil {
+			r.err = r.ctx.Err()
+		}
+		r.listener(r.ctx, classify(r.err))
+	}
+
+	return err
+}
+
+// the optional interfaces of rows fall back to what database/sql assumes without them
+
+func (r *rows) HasNextResultSet() bool {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+
+	return false
+}
+
+func (r *rows) NextResultSet() error {
+	rs, ok := r.Rows.(driver.RowsNextResultSet)
+	if !ok {
+		return io.EOF
+	}
+
+	err := rs.NextResultSet()
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+
+	return err
+}
+
+var scanTypeAny = reflect.TypeOf(new(interface{})).Elem()
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return ct.ColumnTypeScanType(index)
+	}
+
+	return scanTypeAny
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return ct.ColumnTypeDatabaseTypeName(index)
+	}
+
+	return ""
+}
+
+func (r *rows) ColumnTypeLength(index int) (int64, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return ct.ColumnTypeLength(index)
+	}
+
+	return 0, false
+}
+
+func (r *rows) ColumnTypeNullable(index int) (bool, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return ct.ColumnTypeNullable(index)
+	}
+
+	return false, false
+}
+
+func (r *rows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return ct.ColumnTypePrecisionScale(index)
+	}
+
+	return 0, 0, false
+}
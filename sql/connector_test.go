@@ -0,0 +1,465 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xtracker/limits"
+)
+
+var errQuery = errors.New("query failed")
+
+// fakeDriver is an in-memory driver, the query text selects the behaviour:
+// "fail" returns an error, "wait" blocks until the context is done, "sets" returns two typed result sets,
+// anything else succeeds with one row
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return &fakeConn{}, nil
+}
+
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{}, nil
+}
+
+func (fakeConnector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+// closingConnector records that it was closed by sql.DB.Close
+type closingConnector struct {
+	fakeConnector
+	closed bool
+}
+
+func (c *closingConnector) Close() error {
+	c.closed = true
+	return nil
+}
+
+// checkingConnector connects conns that convert custom arguments themselves
+type checkingConnector struct {
+	fakeConnector
+}
+
+func (checkingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &checkingConn{}, nil
+}
+
+type custom struct {
+	v int64
+}
+
+// checkingConn only has a NamedValueChecker on the conn, not on its stmts
+type checkingConn struct {
+	fakeConn
+}
+
+func (*checkingConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := nv.Value.(custom); ok {
+		nv.Value = c.v
+		return nil
+	}
+
+	return driver.ErrSkip
+}
+
+type fakeConn struct{}
+
+func (*fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if query == "convert" {
+		return &convertingStmt{fakeStmt{query: query}}, nil
+	}
+
+	return &fakeStmt{query: query}, nil
+}
+
+func (*fakeConn) Close() error {
+	return nil
+}
+
+func (*fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (*fakeConn) ExecContext(ctx context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if err := run(ctx, query); err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (*fakeConn) QueryContext(ctx context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if err := run(ctx, query); err != nil {
+		return nil, err
+	}
+
+	if query == "sets" {
+		return &fakeSetsRows{}, nil
+	}
+
+	return &fakeRows{}, nil
+}
+
+func run(ctx context.Context, query string) error {
+	switch query {
+	case "fail":
+		return errQuery
+	case "wait":
+		<-ctx.Done()
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
+
+// fakeStmt only implements the legacy interface, to cover the fallback path
+type fakeStmt struct {
+	query string
+}
+
+func (*fakeStmt) Close() error {
+	return nil
+}
+
+func (*fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if err := run(context.Background(), s.query); err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if err := run(context.Background(), s.query); err != nil {
+		return nil, err
+	}
+
+	return &fakeRows{}, nil
+}
+
+// convertingStmt rejects negative arguments in its column converter
+type convertingStmt struct {
+	fakeStmt
+}
+
+func (*convertingStmt) ColumnConverter(int) driver.ValueConverter {
+	return positiveConverter{}
+}
+
+var errNegative = errors.New("negative argument")
+
+type positiveConverter struct{}
+
+func (positiveConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	if i, ok := v.(int64); ok && i < 0 {
+		return nil, errNegative
+	}
+
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeRows struct {
+	done bool
+}
+
+func (*fakeRows) Columns() []string {
+	return []string{"v"}
+}
+
+func (*fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+// fakeSetsRows has two result sets of one row each and describes its column
+type fakeSetsRows struct {
+	fakeRows
+	set int
+}
+
+func (r *fakeSetsRows) HasNextResultSet() bool {
+	return r.set == 0
+}
+
+func (r *fakeSetsRows) NextResultSet() error {
+	if r.set > 0 {
+		return io.EOF
+	}
+
+	r.set++
+	r.done = false
+	return nil
+}
+
+func (*fakeSetsRows) ColumnTypeScanType(int) reflect.Type {
+	return reflect.TypeOf(int64(0))
+}
+
+func (*fakeSetsRows) ColumnTypeDatabaseTypeName(int) string {
+	return "BIGINT"
+}
+
+func (*fakeSetsRows) ColumnTypeLength(int) (int64, bool) {
+	return 8, true
+}
+
+func (*fakeSetsRows) ColumnTypeNullable(int) (bool, bool) {
+	return true, true
+}
+
+func (*fakeSetsRows) ColumnTypePrecisionScale(int) (int64, int64, bool) {
+	return 19, 0, true
+}
+
+// countingLimiter admits up to max requests and records the results
+type countingLimiter struct {
+	sync.Mutex
+	max      int
+	inFlight int
+	results  []limits.Result
+}
+
+func (c *countingLimiter) Acquire(context.Context) (limits.Listener, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.inFlight >= c.max {
+		return nil, errors.New("limit exceeded")
+	}
+
+	c.inFlight++
+	return func(_ context.Context, result limits.Result) {
+		c.Lock()
+		defer c.Unlock()
+
+		c.inFlight--
+		c.results = append(c.results, result)
+	}, nil
+}
+
+func (c *countingLimiter) snapshot() (int, []limits.Result) {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.inFlight, append([]limits.Result(nil), c.results...)
+}
+
+func openDB(t *testing.T, l limits.Limiter) *sql.DB {
+	t.Helper()
+
+	db := sql.OpenDB(NewConnector(fakeConnector{}, l))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestConnectorResults(t *testing.T) {
+	l := &countingLimiter{max: 10}
+	db := openDB(t, l)
+
+	if _, err := db.Exec("insert"); err != nil {
+		t.Fatal(err)
+	}
+
+	var v int
+	if err := db.QueryRow("select").Scan(&v); err != nil || v != 1 {
+		t.Fatalf("unexpected result %v %v", v, err)
+	}
+
+	if _, err := db.Exec("fail"); !errors.Is(err, errQuery) {
+		t.Fatalf("expected driver error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := db.QueryContext(ctx, "wait"); err == nil {
+		t.Fatal("expected context error")
+	}
+
+	// prepared statements go through the legacy driver interface
+	stmt, err := db.Prepare("update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	inFlight, results := l.snapshot()
+	expected := []limits.Result{limits.SUCCESS, limits.SUCCESS, limits.DROPPED, limits.DROPPED, limits.SUCCESS}
+	if inFlight != 0 || len(results) != len(expected) {
+		t.Fatalf("expected results %v with nothing in flight, got %v, %d in flight", expected, results, inFlight)
+	}
+
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Fatalf("expected results %v, got %v", expected, results)
+		}
+	}
+}
+
+func TestConnectorLimitExceeded(t *testing.T) {
+	l := &countingLimiter{max: 1}
+	db := openDB(t, l)
+
+	// open rows keep their permit
+	rows, err := db.Query("select")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("insert")
+	var limitErr *LimitExceededError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected limit exceeded error, got %v", err)
+	}
+
+	rows.Close()
+	if _, err := db.Exec("insert"); err != nil {
+		t.Fatalf("expected permit to be released with the rows, got %v", err)
+	}
+}
+
+func TestConnectorClose(t *testing.T) {
+	c := &closingConnector{}
+	db := sql.OpenDB(NewConnector(c, &countingLimiter{max: 1}))
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.closed {
+		t.Fatal("expected the inner connector to be closed")
+	}
+}
+
+func TestConnectorBeginTx(t *testing.T) {
+	db := openDB(t, &countingLimiter{max: 1})
+	ctx := context.Background()
+
+	// the fake conn only has Begin, so the options it can't honour are rejected
+	if _, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err == nil {
+		t.Fatal("expected read-only transactions to be rejected")
+	}
+
+	if _, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable}); err == nil {
+		t.Fatal("expected non-default isolation to be rejected")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectorResultSets(t *testing.T) {
+	l := &countingLimiter{max: 1}
+	db := openDB(t, l)
+
+	rows, err := db.Query("sets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := types[0]
+	length, _ := ct.Length()
+	nullable, _ := ct.Nullable()
+	precision, _, _ := ct.DecimalSize()
+	if ct.ScanType() != reflect.TypeOf(int64(0)) || ct.DatabaseTypeName() != "BIGINT" || length != 8 || !nullable || precision != 19 {
+		t.Fatalf("unexpected column type %v %q %d %v %d", ct.ScanType(), ct.DatabaseTypeName(), length, nullable, precision)
+	}
+
+	sets := 0
+	for {
+		for rows.Next() {
+		}
+		sets++
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+
+	if err := rows.Err(); err != nil || sets != 2 {
+		t.Fatalf("expected 2 result sets, got %d %v", sets, err)
+	}
+
+	rows.Close()
+	if inFlight, results := l.snapshot(); inFlight != 0 || len(results) != 1 || results[0] != limits.SUCCESS {
+		t.Fatalf("expected one success, got %v, %d in flight", results, inFlight)
+	}
+}
+
+func TestConnectorColumnConverter(t *testing.T) {
+	db := openDB(t, &countingLimiter{max: 1})
+
+	stmt, err := db.Prepare("convert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(int64(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := stmt.Exec(int64(-1)); !errors.Is(err, errNegative) {
+		t.Fatalf("expected the column converter of the stmt to run, got %v", err)
+	}
+}
+
+func TestConnectorConnChecker(t *testing.T) {
+	db := sql.OpenDB(NewConnector(checkingConnector{}, &countingLimiter{max: 1}))
+	t.Cleanup(func() { db.Close() })
+
+	stmt, err := db.Prepare("update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(custom{1}); err != nil {
+		t.Fatalf("expected the checker of the conn to convert the argument, got %v", err)
+	}
+}